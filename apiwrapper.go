@@ -2,8 +2,11 @@ package gdrive // nolint: golint
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
@@ -14,27 +17,106 @@ import (
 
 // APIWrapper allows to wrap some GDrive API calls to perform some caching
 type APIWrapper struct {
-	UseCache bool
-	srv      *drive.Service
-	cache    *cache.Cache
-	logger   log.Logger
-	calls    map[string]*int32
+	UseCache    bool
+	srv         *drive.Service
+	cache       *cache.Cache
+	logger      log.Logger
+	calls       map[string]*int32
+	ctx         context.Context
+	limiter     RateLimiter
+	retryPolicy *RetryPolicy
+	listings    *listingsState
+	store       CacheStore
+}
+
+// DefaultCacheConfig is the configuration of the lookups cache used by default
+var DefaultCacheConfig = cache.Config{
+	TTL:        time.Hour,
+	MaxEntries: 100000,
+	MaxBytes:   64 << 20,
+	SizeOf:     cacheEntrySize,
+}
+
+// cacheEntrySize estimates the memory used by a cached lookup
+func cacheEntrySize(key string, value interface{}) int64 {
+	const overhead = 128
+
+	size := int64(overhead + len(key))
+
+	var files []*drive.File
+
+	switch v := value.(type) {
+	case *drive.FileList:
+		files = v.Files
+	case []*drive.File:
+		files = v
+	case *folderListing:
+		files = v.files
+		size += int64(len(v.byName)) * overhead
+	}
+
+	for _, f := range files {
+		size += overhead + int64(len(f.Id)+len(f.Name)+len(f.MimeType)+len(f.DriveId)+
+			len(f.CreatedTime)+len(f.ModifiedTime)+len(f.Md5Checksum))
+
+		for _, p := range f.Parents {
+			size += int64(len(p))
+		}
+
+		for _, p := range f.PermissionIds {
+			size += int64(len(p))
+		}
+
+		for k, v := range f.Properties {
+			size += int64(len(k) + len(v))
+		}
+	}
+
+	return size
 }
 
 // NewAPIWrapper instantiates a new APIWrapper
 func NewAPIWrapper(srv *drive.Service, logger log.Logger) *APIWrapper {
 	return &APIWrapper{
 		srv:    srv,
-		cache:  cache.NewCache(),
+		cache:  cache.NewCacheWithConfig(DefaultCacheConfig),
 		logger: logger,
 		calls: map[string]*int32{
 			"Files.Create": new(int32),
 			"Files.Update": new(int32),
 			"Files.Delete": new(int32),
 			"Files.List":   new(int32),
+			"Files.Get":    new(int32),
+			"Drives.List":  new(int32),
 		},
 		UseCache: true,
+		listings: &listingsState{},
+		limiter:  noRateLimiter{},
+		retryPolicy: &RetryPolicy{
+			MaxAttempts: 1,
+		},
+	}
+}
+
+// withContext returns a copy of the wrapper whose calls are bound to ctx, the cache and counters are shared
+func (a *APIWrapper) withContext(ctx context.Context) *APIWrapper {
+	view := *a
+	view.ctx = ctx
+
+	return &view
+}
+
+func (a *APIWrapper) context() context.Context {
+	if a.ctx != nil {
+		return a.ctx
 	}
+
+	return context.Background()
+}
+
+// callAPI performs a rate limited API call, and retries it if it fails with a transient error
+func (a *APIWrapper) callAPI(kind CallKind, idempotent bool, call func() error) error {
+	return callAPI(a.context(), a.limiter, a.retryPolicy, kind, idempotent, call)
 }
 
 func (a *APIWrapper) calling(apiName string) {
@@ -51,13 +133,9 @@ func (a *APIWrapper) TotalNbCalls() int {
 	return int(nb)
 }
 
-// createFile wraps a call to the Files.Create
-func (a *APIWrapper) createFile(
-	folderID string,
-	fileName string,
-	mimeType string,
-	fields ...googleapi.Field,
-) (*drive.File, error) {
+// createFile wraps a call to the Files.Create. The file is returned with the fields of the listings, and added to the
+// snapshot of its folder.
+func (a *APIWrapper) createFile(folderID string, fileName string, mimeType string) (*drive.File, error) {
 	a.calling("Files.Create")
 
 	call := a.srv.Files.Create(&drive.File{
@@ -67,26 +145,34 @@ func (a *APIWrapper) createFile(
 		Parents: []string{
 			folderID,
 		},
-	}).Fields(fields...).SupportsAllDrives(true)
+	}).Fields(listingFileFields...).SupportsAllDrives(true)
 
 	if mimeType != mimeTypeFolder {
 		call.Media(bytes.NewReader([]byte{}))
 	}
 
-	RateLimit()
-	file, err := call.Do()
+	var file *drive.File
 
-	if err == nil {
-		a.cache.CleanupByPrefix(fmt.Sprintf("%s-", folderID))
-	} else {
-		err = &DriveAPICallError{Err: err}
+	// A creation isn't idempotent, it's only retried if it was rejected by the rate limiting
+	err := a.callAPI(CallWrite, false, func() error {
+		var err error
+		file, err = call.Context(a.context()).Do()
+
+		return err
+	})
+
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
 	}
 
-	return file, err
+	a.fileUpdated(file, []string{folderID})
+
+	return file, nil
 }
 
-// nolint: unused
-func (a *APIWrapper) renameFile(file *drive.File, targetFolder *drive.File, targetName string) error {
+// renameFile wraps a call to Files.Update that renames and moves a file. The snapshots of its previous and new
+// folders are updated.
+func (a *APIWrapper) renameFile(file *drive.File, targetFolder *drive.File, targetName string) (*drive.File, error) {
 	a.calling("Files.Update")
 
 	call := a.srv.Files.Update(
@@ -94,41 +180,111 @@ func (a *APIWrapper) renameFile(file *drive.File, targetFolder *drive.File, targ
 		&drive.File{
 			Name: sanitizeName(targetName),
 		},
-	).SupportsAllDrives(true)
+	).Fields(listingFileFields...).SupportsAllDrives(true)
 
-	if file.Parents[0] != targetFolder.Id {
-		call = call.
-			RemoveParents(file.Parents[0]).
-			AddParents(targetFolder.Id)
+	var previousParents []string
+
+	moved := true
+
+	for _, p := range file.Parents {
+		if p == targetFolder.Id {
+			moved = false
+		} else {
+			previousParents = append(previousParents, p)
+		}
 	}
 
-	RateLimit()
-	_, err := call.Do()
+	if moved {
+		call = call.AddParents(targetFolder.Id)
+	}
+
+	if len(previousParents) > 0 {
+		call = call.RemoveParents(strings.Join(previousParents, ","))
+	}
+
+	var renamed *drive.File
+
+	err := a.callAPI(CallWrite, true, func() error {
+		var err error
+		renamed, err = call.Context(a.context()).Do()
+
+		return err
+	})
 
 	if err != nil {
-		return &DriveAPICallError{Err: err}
+		return nil, &DriveAPICallError{Err: err}
 	}
 
-	// Removing cache of source and target folders
-	a.cache.CleanupByPrefix(fmt.Sprintf("%s-", file.Parents[0]))
-	a.cache.CleanupByPrefix(fmt.Sprintf("%s-", targetFolder.Id))
+	for _, p := range previousParents {
+		a.removeFromListing(p, file.Id)
+	}
 
-	return nil
+	if file.MimeType == mimeTypeFolder {
+		a.forgetResolvedPaths(file.Id)
+	}
+
+	a.fileUpdated(renamed, []string{targetFolder.Id})
+
+	return renamed, nil
+}
+
+// restoreFile wraps a call to Files.Update that restores a trashed file, and moves it to a target folder if it's not
+// nil. The file is added to the snapshots of its folders.
+func (a *APIWrapper) restoreFile(file *drive.File, targetFolder *drive.File) (*drive.File, error) {
+	a.calling("Files.Update")
+
+	call := a.srv.Files.Update(
+		file.Id,
+		&drive.File{
+			Trashed:         false,
+			ForceSendFields: []string{"Trashed"},
+		},
+	).Fields(listingFileFields...).SupportsAllDrives(true)
+
+	if targetFolder != nil {
+		call = call.AddParents(targetFolder.Id).RemoveParents(strings.Join(file.Parents, ","))
+	}
+
+	var restored *drive.File
+
+	err := a.callAPI(CallWrite, true, func() error {
+		var err error
+		restored, err = call.Context(a.context()).Do()
+
+		return err
+	})
+
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	a.fileUpdated(restored, nil)
+
+	return restored, nil
 }
 
 // deleteFile wraps a call to Files.Update or Files.Delete
-// To keep it simple and yet true, when a folder is deleted the entire cache is trashed
+// The file is removed from the snapshots of its folders. When a folder is deleted, the lookups done in it are evicted,
+// the ones done in its sub-folders can't be reached anymore.
 func (a *APIWrapper) deleteFile(file *drive.File, trash bool) error {
 	var err error
 
 	if trash {
 		a.calling("Files.Update")
-		RateLimit()
-		_, err = a.srv.Files.Update(file.Id, &drive.File{Trashed: true}).SupportsAllDrives(true).Do()
+		err = a.callAPI(CallWrite, true, func() error {
+			_, err := a.srv.Files.Update(file.Id, &drive.File{Trashed: true}).
+				SupportsAllDrives(true).
+				Context(a.context()).
+				Do()
+
+			return err
+		})
 	} else {
+		// A deletion that failed in the middle could make the retry fail with a "not found" error
 		a.calling("Files.Delete")
-		RateLimit()
-		err = a.srv.Files.Delete(file.Id).SupportsAllDrives(true).Do()
+		err = a.callAPI(CallWrite, false, func() error {
+			return a.srv.Files.Delete(file.Id).SupportsAllDrives(true).Context(a.context()).Do()
+		})
 	}
 
 	if err != nil {
@@ -136,18 +292,31 @@ func (a *APIWrapper) deleteFile(file *drive.File, trash bool) error {
 	}
 
 	if file.MimeType == mimeTypeFolder {
-		a.cache.CleanupEverything()
-	} else {
-		for _, p := range file.Parents {
-			a.cache.CleanupByPrefix(p)
-		}
+		a.cache.CleanupByPrefix(fmt.Sprintf("%s-", file.Id))
+		a.forgetResolvedPaths(file.Id)
+		a.deletePersistedListings(file.Id)
+	}
+
+	if len(file.Parents) == 0 {
+		// We don't know where it was
+		a.forgetFile(file.Id)
+	}
+
+	for _, p := range file.Parents {
+		a.removeFromListing(p, file.Id)
 	}
 
 	return nil
 }
 
+// forgetFile evicts the cached and persisted lookups and listings that found a file
+func (a *APIWrapper) forgetFile(fileID string) {
+	a.cache.CleanupTagged(fileID, nil)
+	a.deletePersistedListings(a.persistedFoldersOf(fileID)...)
+}
+
 func (a *APIWrapper) getFileByFolderAndName(
-	folderID string,
+	folder *drive.File,
 	fileName string,
 	fields ...googleapi.Field,
 ) (*drive.FileList, error) {
@@ -156,32 +325,236 @@ func (a *APIWrapper) getFileByFolderAndName(
 		queryFields = "files(id,mimeType,parents)"
 	}
 
-	cacheKey := fmt.Sprintf("%s-getFileByFolderAndName-%s-%s", folderID, fileName, queryFields)
+	// The lookups are answered by the listing of the folder, unless they need some fields that it doesn't have
+	if a.UseCache && coveredByListing(queryFields) {
+		listing, err := a.listFolder(folder)
+		if err != nil {
+			return nil, err
+		}
+
+		return &drive.FileList{Files: listing.lookup(fileName)}, nil
+	}
+
+	cacheKey := fmt.Sprintf("%s-getFileByFolderAndName-%s-%s", folder.Id, fileName, queryFields)
 	value, ok := a.cache.Get(cacheKey)
 
 	if ok {
 		return value.(*drive.FileList), nil
 	}
 
-	fileList, err := a._getFileByFolderAndName(folderID, fileName, googleapi.Field(queryFields))
+	fileList, err := a._getFileByFolderAndName(folder, fileName, googleapi.Field(queryFields))
+
+	if err == nil {
+		// The files are in the drive of their folder, even if the driveId field wasn't requested
+		for _, file := range fileList.Files {
+			file.DriveId = folder.DriveId
+		}
+	}
 
 	if err == nil && a.UseCache {
-		a.cache.Set(cacheKey, fileList)
+		a.cache.SetTagged(cacheKey, fileList, append(fileIDs(fileList.Files), lookupTag(folder.Id, fileName))...)
 	}
 
 	return fileList, err
 }
 
 func (a *APIWrapper) _getFileByFolderAndName(
-	folderID string,
+	folder *drive.File,
 	fileName string,
 	fields googleapi.Field,
 ) (*drive.FileList, error) {
 	a.calling("Files.List")
 
-	query := fmt.Sprintf("'%s' in parents and name='%s' and trashed = false", folderID, sanitizeName(fileName))
-	call := a.srv.Files.List().Q(query).Fields(fields).SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+	query := fmt.Sprintf("'%s' in parents and name='%s' and trashed = false", folder.Id, sanitizeName(fileName))
+	call := inDrive(a.srv.Files.List().Q(query), folder.DriveId).
+		Fields(fields).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true)
+
+	var fileList *drive.FileList
+
+	err := a.callAPI(CallRead, true, func() error {
+		var err error
+		fileList, err = call.Context(a.context()).Do()
+
+		return err
+	})
+
+	return fileList, err
+}
+
+// driveRootsCacheKey is the cache key of the root folders of the drives
+const driveRootsCacheKey = "getDriveRoots"
+
+// getDriveRoots returns the root folders of My Drive and of the shared drives
+func (a *APIWrapper) getDriveRoots() ([]*drive.File, error) {
+	if value, ok := a.cache.Get(driveRootsCacheKey); ok {
+		return value.([]*drive.File), nil
+	}
+
+	var myDrive *drive.File
+
+	a.calling("Files.Get")
+
+	err := a.callAPI(CallRead, true, func() error {
+		var err error
+		myDrive, err = a.srv.Files.Get("root").Fields(fileInfoFields...).Context(a.context()).Do()
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []*drive.File{myDrive}
+	pageToken := ""
+
+	for {
+		call := a.srv.Drives.List().PageSize(drivesListPageSize).Fields("nextPageToken,drives(id,name,createdTime)")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var drives *drive.DriveList
+
+		a.calling("Drives.List")
+
+		err := a.callAPI(CallRead, true, func() error {
+			var err error
+			drives, err = call.Context(a.context()).Do()
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The root folder of a shared drive has the ID of the drive
+		for _, d := range drives.Drives {
+			roots = append(roots, &drive.File{
+				Id:           d.Id,
+				DriveId:      d.Id,
+				Name:         d.Name,
+				MimeType:     mimeTypeFolder,
+				CreatedTime:  d.CreatedTime,
+				ModifiedTime: d.CreatedTime,
+			})
+		}
+
+		if pageToken = drives.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	if a.UseCache {
+		a.cache.Set(driveRootsCacheKey, roots)
+	}
+
+	return roots, nil
+}
+
+// applyChange evicts the cached lookups affected by a change made on Google Drive, and returns how many were evicted
+func (a *APIWrapper) applyChange(change *drive.Change) int {
+	if change.ChangeType == "drive" {
+		if change.Removed {
+			a.deletePersistedListings(change.DriveId)
+		}
+
+		evicted := 0
+		if a.cache.Delete(driveRootsCacheKey) {
+			evicted++
+		}
+
+		// The root folder of a shared drive has the ID of the drive
+		return evicted + a.cache.CleanupTagged(change.DriveId, nil)
+	}
+
+	fileID := change.FileId
+	gone := change.Removed || change.File == nil || change.File.Trashed
+
+	var current *drive.File
+
+	if !gone {
+		current = change.File
+	}
+
+	// The persisted listings that found the file, and the ones of its current folders unless they're up to date
+	var persisted []string
+
+	for _, folderID := range append(a.persistedFoldersOf(fileID), fileParents(current)...) {
+		if current == nil || !a.persistedListingHas(folderID, current) {
+			persisted = append(persisted, folderID)
+		}
+	}
+
+	if gone {
+		persisted = append(persisted, fileID)
+	}
+
+	a.deletePersistedListings(persisted...)
+
+	evicted := 0
+
+	// The lookups done in a folder that doesn't exist anymore
+	if gone {
+		evicted += a.cache.CleanupByPrefix(fileID + "-")
+	}
+
+	listingKeys := make(map[string]bool)
+
+	for _, p := range fileParents(current) {
+		key := listingKey(p)
+		listingKeys[key] = true
+
+		// The listings of its current folders, they might not have it or have a previous version of it. The changes
+		// made through the driver are already applied to them.
+		if value, ok := a.cache.Get(key); ok && !hasVersion(value.(*folderListing).files, current) && a.cache.Delete(key) {
+			evicted++
+		}
+
+		// The lookups of its current name in its current folders, they might not have found it
+		evicted += a.cache.CleanupTagged(lookupTag(p, current.Name), nil)
+	}
+
+	// The lookups and listings that found the file, wherever it was and whatever its name was
+	return evicted + a.cache.CleanupTagged(fileID, func(key string, _ interface{}) bool {
+		return !listingKeys[key]
+	})
+}
+
+// fileParents returns the parents of a file, if it isn't nil
+func fileParents(file *drive.File) []string {
+	if file == nil {
+		return nil
+	}
+
+	return file.Parents
+}
+
+// hasVersion returns true if some files contain a version of a file that has the same name, type, size and
+// modification time
+func hasVersion(files []*drive.File, file *drive.File) bool {
+	for _, f := range files {
+		if f.Id == file.Id {
+			return f.Name == file.Name && f.MimeType == file.MimeType &&
+				f.ModifiedTime == file.ModifiedTime && f.Size == file.Size
+		}
+	}
+
+	return false
+}
+
+// fileIDs returns the IDs of some files, the cached lookups and listings are tagged with the files they contain
+func fileIDs(files []*drive.File) []string {
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.Id)
+	}
+
+	return ids
+}
 
-	RateLimit()
-	return call.Do()
+// lookupTag tags the cached lookups of a name in a folder, whatever its case, to evict them when a file gets this name
+func lookupTag(folderID, name string) string {
+	return fmt.Sprintf("lookup:%s/%s", folderID, strings.ToLower(name))
 }
@@ -0,0 +1,246 @@
+// Package blockcache keeps fixed-size blocks of content in the files of a local directory, within a size limit
+package blockcache
+
+import (
+	"container/list"
+	"crypto/sha1" // nolint: gosec
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// tmpSuffix is the suffix of the blocks being written
+const tmpSuffix = ".tmp"
+
+// Stats contains the counters of a cache
+type Stats struct {
+	Hits      int64 // Hits is the number of blocks that were found
+	Misses    int64 // Misses is the number of blocks that weren't found
+	Evictions int64 // Evictions is the number of blocks removed to respect the size limit
+	Blocks    int   // Blocks is the current number of blocks
+	Bytes     int64 // Bytes is the current size of the blocks
+}
+
+type entry struct {
+	name string // name is the name of the file of the block
+	size int64  // size is the size of the block
+}
+
+// Cache stores blocks of content, identified by a key and their index, in a directory. The blocks that weren't used
+// recently are removed when the size limit is reached. The blocks written by a previous instance are used again.
+type Cache struct {
+	mutex     sync.Mutex
+	directory string                   // directory contains a file per block
+	maxBytes  int64                    // maxBytes is the maximum size of the blocks
+	entries   map[string]*list.Element // entries are the elements of the blocks in lru, by name
+	lru       *list.List               // lru contains the entries, the most recently used first
+	stats     Stats
+}
+
+// New opens a cache in a directory, it's created if it doesn't exist. A maxBytes that isn't positive means there's
+// no size limit.
+func New(directory string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("couldn't create the cache directory: %w", err)
+	}
+
+	c := &Cache{
+		directory: directory,
+		maxBytes:  maxBytes,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load indexes the blocks present in the directory, the most recently written being considered the most recently used
+func (c *Cache) load() error {
+	infos, err := ioutil.ReadDir(c.directory)
+	if err != nil {
+		return fmt.Errorf("couldn't list the cache directory: %w", err)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		// The blocks that were being written when the process stopped
+		if strings.HasSuffix(info.Name(), tmpSuffix) {
+			_ = os.Remove(filepath.Join(c.directory, info.Name()))
+			continue
+		}
+
+		if !validName(info.Name()) {
+			continue
+		}
+
+		c.entries[info.Name()] = c.lru.PushFront(&entry{name: info.Name(), size: info.Size()})
+		c.stats.Bytes += info.Size()
+	}
+
+	c.evict()
+
+	return nil
+}
+
+// blockName returns the name of the file of a block
+func blockName(key string, index int64) string {
+	hash := sha1.Sum([]byte(key)) // nolint: gosec
+
+	return hex.EncodeToString(hash[:]) + "-" + strconv.FormatInt(index, 10)
+}
+
+// validName returns true if a file name is the one of a block
+func validName(name string) bool {
+	parts := strings.Split(name, "-")
+	if len(parts) != 2 || len(parts[0]) != 2*sha1.Size {
+		return false
+	}
+
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return false
+	}
+
+	_, err := strconv.ParseInt(parts[1], 10, 64)
+
+	return err == nil
+}
+
+// Get returns a block, if it's in the cache
+func (c *Cache) Get(key string, index int64) ([]byte, bool) {
+	name := blockName(key, index)
+
+	c.mutex.Lock()
+	element, ok := c.entries[name]
+
+	if ok {
+		c.lru.MoveToFront(element)
+	}
+	c.mutex.Unlock()
+
+	var data []byte
+
+	if ok {
+		var err error
+
+		// The block might have been evicted meanwhile
+		if data, err = ioutil.ReadFile(filepath.Join(c.directory, name)); err != nil {
+			ok = false
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if ok {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+
+	return data, ok
+}
+
+// Set adds a block to the cache, the least recently used blocks are removed if the size limit is reached
+func (c *Cache) Set(key string, index int64, data []byte) error {
+	size := int64(len(data))
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(c.directory, "*"+tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("couldn't create a block: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("couldn't write a block: %w", err)
+	}
+
+	name := blockName(key, index)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.directory, name)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("couldn't write a block: %w", err)
+	}
+
+	if element, ok := c.entries[name]; ok {
+		c.stats.Bytes -= element.Value.(*entry).size
+		element.Value.(*entry).size = size
+		c.lru.MoveToFront(element)
+	} else {
+		c.entries[name] = c.lru.PushFront(&entry{name: name, size: size})
+	}
+
+	c.stats.Bytes += size
+
+	c.evict()
+
+	return nil
+}
+
+// evict removes the least recently used blocks until the size limit is respected, the lock has to be held
+func (c *Cache) evict() {
+	for c.maxBytes > 0 && c.stats.Bytes > c.maxBytes && c.lru.Len() > 0 {
+		e := c.lru.Remove(c.lru.Back()).(*entry)
+		delete(c.entries, e.name)
+		c.stats.Bytes -= e.size
+		c.stats.Evictions++
+
+		_ = os.Remove(filepath.Join(c.directory, e.name))
+	}
+}
+
+// Clear removes all the blocks
+func (c *Cache) Clear() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var err error
+
+	for name := range c.entries {
+		if errRemove := os.Remove(filepath.Join(c.directory, name)); errRemove != nil && !os.IsNotExist(errRemove) {
+			err = errRemove
+		}
+	}
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.stats.Bytes = 0
+
+	return err
+}
+
+// Stats returns the counters of the cache
+func (c *Cache) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Blocks = len(c.entries)
+
+	return stats
+}
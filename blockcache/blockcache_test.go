@@ -0,0 +1,106 @@
+package blockcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "blockcache")
+	require.NoError(t, err)
+
+	return dir
+}
+
+func TestBasics(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	c, err := New(dir, 0)
+	require.NoError(t, err)
+
+	_, ok := c.Get("file1", 0)
+	require.False(t, ok)
+
+	require.NoError(t, c.Set("file1", 0, []byte("block0")))
+	require.NoError(t, c.Set("file1", 1, []byte("block1")))
+	require.NoError(t, c.Set("file1", 1, []byte("block1bis")))
+
+	data, ok := c.Get("file1", 1)
+	require.True(t, ok)
+	require.Equal(t, "block1bis", string(data))
+
+	_, ok = c.Get("file2", 0)
+	require.False(t, ok)
+
+	stats := c.Stats()
+	require.EqualValues(t, 1, stats.Hits)
+	require.EqualValues(t, 2, stats.Misses)
+	require.Equal(t, 2, stats.Blocks)
+	require.EqualValues(t, 15, stats.Bytes)
+
+	require.NoError(t, c.Clear())
+	_, ok = c.Get("file1", 0)
+	require.False(t, ok)
+	require.Zero(t, c.Stats().Bytes)
+}
+
+func TestLRU(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	c, err := New(dir, 10)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Set("file1", 0, []byte("1234")))
+	require.NoError(t, c.Set("file1", 1, []byte("1234")))
+
+	// The first block is now the most recently used
+	_, ok := c.Get("file1", 0)
+	require.True(t, ok)
+
+	require.NoError(t, c.Set("file1", 2, []byte("1234")))
+
+	_, ok = c.Get("file1", 1)
+	require.False(t, ok)
+
+	_, ok = c.Get("file1", 0)
+	require.True(t, ok)
+
+	// Too big to be cached
+	require.NoError(t, c.Set("file2", 0, []byte("12345678901")))
+	_, ok = c.Get("file2", 0)
+	require.False(t, ok)
+
+	stats := c.Stats()
+	require.EqualValues(t, 1, stats.Evictions)
+	require.EqualValues(t, 8, stats.Bytes)
+}
+
+func TestReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	c, err := New(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, c.Set("file1", 0, []byte("block0")))
+
+	// A block that was being written, and a file that isn't a block
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "123.tmp"), []byte("partial"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other"), []byte("other"), 0600))
+
+	c, err = New(dir, 0)
+	require.NoError(t, err)
+
+	data, ok := c.Get("file1", 0)
+	require.True(t, ok)
+	require.Equal(t, "block0", string(data))
+	require.Equal(t, 1, c.Stats().Blocks)
+
+	_, err = os.Stat(filepath.Join(dir, "123.tmp"))
+	require.True(t, os.IsNotExist(err))
+}
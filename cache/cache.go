@@ -1,45 +1,227 @@
-// Package cache allows to
+// Package cache allows to keep values in memory, with an optional expiration and size bound
 package cache
 
 import (
+	"container/list"
 	"strings"
 	"sync"
+	"time"
 )
 
+// Config defines the limits of a cache. The zero value means an unbounded cache whose entries never expire.
+type Config struct {
+	TTL        time.Duration                             // TTL is the default time to live of the entries
+	MaxEntries int                                       // MaxEntries is the maximum number of entries
+	MaxBytes   int64                                     // MaxBytes is the maximum estimated size of the entries
+	SizeOf     func(key string, value interface{}) int64 // SizeOf estimates the size of an entry
+	Separator  string                                    // Separator ends the bucket part of the keys, "-" if empty
+}
+
+// Stats contains the counters of a cache
+type Stats struct {
+	Hits        int64 // Hits is the number of lookups that found a value
+	Misses      int64 // Misses is the number of lookups that didn't find a value (or found an expired one)
+	Evictions   int64 // Evictions is the number of entries removed to respect the size limits
+	Expirations int64 // Expirations is the number of entries removed because they expired
+	Entries     int   // Entries is the current number of entries
+	Bytes       int64 // Bytes is the current estimated size of the entries
+}
+
 type item struct {
-	value interface{}
+	key     string
+	bucket  string
+	value   interface{}
+	tags    []string
+	size    int64
+	expires time.Time
+	element *list.Element
 }
 
-// Cache management
+func (i *item) expired(now time.Time) bool {
+	return !i.expires.IsZero() && now.After(i.expires)
+}
+
+// Cache management. The keys are grouped in buckets by their part before the first separator, so that the
+// entries sharing a prefix (like the lookups done in a folder) can be removed without scanning the whole cache. The
+// entries can also be tagged (like with the files they contain), to remove the ones having a tag the same way.
 type Cache struct {
-	mutex sync.RWMutex
-	items map[string]*item
+	mutex   sync.Mutex
+	config  Config
+	items   map[string]*item
+	buckets map[string]map[string]*item
+	tagged  map[string]map[string]*item // tagged indexes the items by their tags
+	lru     *list.List                  // lru contains the items, the most recently used first
+	stats   Stats
 }
 
-// NewCache creates a new cache instance
+// NewCache creates a new unbounded cache instance
 func NewCache() *Cache {
+	return NewCacheWithConfig(Config{})
+}
+
+// NewCacheWithConfig creates a new cache instance with some limits
+func NewCacheWithConfig(config Config) *Cache {
+	if config.Separator == "" {
+		config.Separator = "-"
+	}
+
+	if config.SizeOf == nil {
+		config.SizeOf = defaultSizeOf
+	}
+
 	return &Cache{
-		items: make(map[string]*item),
+		config:  config,
+		items:   make(map[string]*item),
+		buckets: make(map[string]map[string]*item),
+		tagged:  make(map[string]map[string]*item),
+		lru:     list.New(),
+	}
+}
+
+// entryOverhead is the estimated size of an entry, without its key and value
+const entryOverhead = 128
+
+// defaultSizeOf estimates the size of the entries whose values are strings or byte slices
+func defaultSizeOf(key string, value interface{}) int64 {
+	size := int64(entryOverhead + len(key))
+
+	switch v := value.(type) {
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	}
+
+	return size
+}
+
+func (c *Cache) bucketOf(key string) string {
+	if i := strings.Index(key, c.config.Separator); i >= 0 {
+		return key[:i]
 	}
+
+	return key
 }
 
-// Set sets a value in the cache
+// Set sets a value in the cache, with the default time to live
 func (c *Cache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.config.TTL)
+}
+
+// SetWithTTL sets a value in the cache that expires after ttl, or never if ttl isn't positive
+func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	c.set(key, value, ttl, nil)
+}
+
+// SetTagged sets a value in the cache with the default time to live, it can be removed with CleanupTagged by any of
+// its tags
+func (c *Cache) SetTagged(key string, value interface{}, tags ...string) {
+	c.set(key, value, c.config.TTL, tags)
+}
+
+func (c *Cache) set(key string, value interface{}, ttl time.Duration, tags []string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.items[key] = &item{value: value}
+
+	if existing, ok := c.items[key]; ok {
+		c.remove(existing)
+	}
+
+	it := &item{
+		key:    key,
+		bucket: c.bucketOf(key),
+		value:  value,
+		tags:   tags,
+		size:   c.config.SizeOf(key, value),
+	}
+
+	if ttl > 0 {
+		it.expires = time.Now().Add(ttl)
+	}
+
+	it.element = c.lru.PushFront(it)
+	c.items[key] = it
+	c.stats.Bytes += it.size
+
+	bucket := c.buckets[it.bucket]
+	if bucket == nil {
+		bucket = make(map[string]*item)
+		c.buckets[it.bucket] = bucket
+	}
+
+	bucket[key] = it
+
+	for _, tag := range tags {
+		items := c.tagged[tag]
+		if items == nil {
+			items = make(map[string]*item)
+			c.tagged[tag] = items
+		}
+
+		items[key] = it
+	}
+
+	c.evict()
+}
+
+// evict removes the least recently used entries until the limits are respected
+func (c *Cache) evict() {
+	for c.lru.Len() > 0 &&
+		(c.config.MaxEntries > 0 && len(c.items) > c.config.MaxEntries ||
+			c.config.MaxBytes > 0 && c.stats.Bytes > c.config.MaxBytes) {
+		c.remove(c.lru.Back().Value.(*item))
+		c.stats.Evictions++
+	}
+}
+
+// remove removes an item, the lock has to be held
+func (c *Cache) remove(it *item) {
+	c.lru.Remove(it.element)
+	delete(c.items, it.key)
+	c.stats.Bytes -= it.size
+
+	if bucket := c.buckets[it.bucket]; bucket != nil {
+		delete(bucket, it.key)
+
+		if len(bucket) == 0 {
+			delete(c.buckets, it.bucket)
+		}
+	}
+
+	for _, tag := range it.tags {
+		if items := c.tagged[tag]; items != nil {
+			delete(items, it.key)
+
+			if len(items) == 0 {
+				delete(c.tagged, tag)
+			}
+		}
+	}
 }
 
 // Get gets a value from the cache
 func (c *Cache) Get(key string) (interface{}, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	if item, found := c.items[key]; found {
-		return item.value, found
+	it, found := c.items[key]
+	if !found {
+		c.stats.Misses++
+		return nil, false
 	}
 
-	return nil, false
+	if it.expired(time.Now()) {
+		c.remove(it)
+		c.stats.Expirations++
+		c.stats.Misses++
+
+		return nil, false
+	}
+
+	c.lru.MoveToFront(it.element)
+	c.stats.Hits++
+
+	return it.value, true
 }
 
 // GetValue gets a value without specifying if it existed in the cache
@@ -48,29 +230,115 @@ func (c *Cache) GetValue(key string) interface{} {
 	return v
 }
 
-// Delete deletes a cache value
-func (c *Cache) Delete(key string) {
+// Delete deletes a cache value, and returns true if it was there
+func (c *Cache) Delete(key string) bool {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	delete(c.items, key)
+	it, ok := c.items[key]
+	if ok {
+		c.remove(it)
+	}
+
+	return ok
 }
 
-// CleanupByPrefix deletes all cache values with a given key prefix
+// CleanupByPrefix deletes all cache values with a given key prefix. When the prefix contains the separator, only
+// the entries of its bucket are scanned.
 func (c *Cache) CleanupByPrefix(prefix string) int {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	count := 0
+	var matching []*item
+
+	if strings.Contains(prefix, c.config.Separator) {
+		for k, it := range c.buckets[c.bucketOf(prefix)] {
+			if strings.HasPrefix(k, prefix) {
+				matching = append(matching, it)
+			}
+		}
+	} else {
+		for name, bucket := range c.buckets {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			for _, it := range bucket {
+				matching = append(matching, it)
+			}
+		}
+	}
+
+	for _, it := range matching {
+		c.remove(it)
+	}
+
+	return len(matching)
+}
+
+// CleanupFunc deletes all cache values for which the function returns true
+func (c *Cache) CleanupFunc(match func(key string, value interface{}) bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var matching []*item
+
+	for k, it := range c.items {
+		if match(k, it.value) {
+			matching = append(matching, it)
+		}
+	}
+
+	for _, it := range matching {
+		c.remove(it)
+	}
+
+	return len(matching)
+}
+
+// CleanupTagged deletes the cache values having a tag for which the function returns true, or all of them if it's
+// nil. Only the entries having the tag are scanned.
+func (c *Cache) CleanupTagged(tag string, match func(key string, value interface{}) bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var matching []*item
 
-	for k := range c.items {
-		if strings.HasPrefix(k, prefix) {
-			delete(c.items, k)
-			count++
+	for k, it := range c.tagged[tag] {
+		if match == nil || match(k, it.value) {
+			matching = append(matching, it)
 		}
 	}
 
-	return count
+	for _, it := range matching {
+		c.remove(it)
+	}
+
+	return len(matching)
+}
+
+// CleanupExpired deletes the expired values, they're otherwise only removed when they're looked up or evicted
+func (c *Cache) CleanupExpired() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+
+	var expired []*item
+
+	for _, it := range c.items {
+		if it.expired(now) {
+			expired = append(expired, it)
+		}
+	}
+
+	for _, it := range expired {
+		c.remove(it)
+	}
+
+	c.stats.Expirations += int64(len(expired))
+
+	return len(expired)
 }
 
 // CleanupEverything resets the cache
@@ -78,4 +346,19 @@ func (c *Cache) CleanupEverything() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.items = make(map[string]*item)
+	c.buckets = make(map[string]map[string]*item)
+	c.tagged = make(map[string]map[string]*item)
+	c.lru.Init()
+	c.stats.Bytes = 0
+}
+
+// Stats returns the counters of the cache
+func (c *Cache) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.items)
+
+	return stats
 }
@@ -3,6 +3,7 @@ package cache
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	ast "github.com/stretchr/testify/assert"
 )
@@ -47,6 +48,129 @@ func TestPrefixCleanup(t *testing.T) {
 	assert.Equal("value3", c.GetValue("pre2-key1"))
 }
 
+func TestFuncCleanup(t *testing.T) {
+	c := NewCache()
+	assert := ast.New(t)
+
+	c.Set("key1", "value1")
+	c.Set("key2", "value2")
+	c.Set("key3", "other")
+
+	assert.Equal(2, c.CleanupFunc(func(key string, value interface{}) bool {
+		return key == "key1" || value == "other"
+	}))
+	assert.Nil(c.GetValue("key1"))
+	assert.Equal("value2", c.GetValue("key2"))
+	assert.Nil(c.GetValue("key3"))
+}
+
+func TestBucketCleanup(t *testing.T) {
+	c := NewCache()
+	assert := ast.New(t)
+
+	c.Set("folder1-a", 1)
+	c.Set("folder1-b", 2)
+	c.Set("folder10-a", 3)
+	c.Set("folder2-a", 4)
+	c.Set("nobucket", 5)
+
+	assert.Equal(2, c.CleanupByPrefix("folder1-"))
+	assert.Equal(3, c.GetValue("folder10-a"))
+
+	assert.Equal(0, c.CleanupByPrefix("folder2-a-"))
+	assert.Equal(2, c.CleanupByPrefix("folder"))
+	assert.Equal(5, c.GetValue("nobucket"))
+	assert.Equal(1, c.Stats().Entries)
+}
+
+func TestTagCleanup(t *testing.T) {
+	c := NewCacheWithConfig(Config{MaxEntries: 3})
+	assert := ast.New(t)
+
+	c.SetTagged("listing1", 1, "file1", "file2")
+	c.SetTagged("listing2", 2, "file2")
+	c.SetTagged("lookup1", "other", "file2")
+	c.Set("untagged", 4)
+
+	// The evicted entries are untagged too
+	assert.Nil(c.GetValue("listing1"))
+	assert.Equal(0, c.CleanupTagged("file1", nil))
+
+	assert.Equal(1, c.CleanupTagged("file2", func(key string, value interface{}) bool {
+		return value == "other"
+	}))
+	assert.Equal(2, c.GetValue("listing2"))
+
+	// Setting a value again replaces its tags
+	c.SetTagged("listing2", 5, "file3")
+	assert.Equal(0, c.CleanupTagged("file2", nil))
+	assert.Equal(1, c.CleanupTagged("file3", nil))
+	assert.Equal(4, c.GetValue("untagged"))
+	assert.Equal(1, c.Stats().Entries)
+}
+
+func TestTTL(t *testing.T) {
+	c := NewCacheWithConfig(Config{TTL: 20 * time.Millisecond})
+	assert := ast.New(t)
+
+	c.Set("key1", "value1")
+	c.SetWithTTL("key2", "value2", time.Hour)
+	c.Set("key3", "value3")
+
+	assert.Equal("value1", c.GetValue("key1"))
+
+	time.Sleep(30 * time.Millisecond)
+
+	assert.Nil(c.GetValue("key1"))
+	assert.Equal("value2", c.GetValue("key2"))
+	assert.Equal(1, c.CleanupExpired())
+
+	stats := c.Stats()
+	assert.EqualValues(2, stats.Expirations)
+	assert.EqualValues(2, stats.Hits)
+	assert.EqualValues(1, stats.Misses)
+	assert.Equal(1, stats.Entries)
+}
+
+func TestLRU(t *testing.T) {
+	t.Run("entries", func(t *testing.T) {
+		c := NewCacheWithConfig(Config{MaxEntries: 2})
+		assert := ast.New(t)
+
+		c.Set("key1", "value1")
+		c.Set("key2", "value2")
+		assert.Equal("value1", c.GetValue("key1"))
+
+		// key2 is the least recently used
+		c.Set("key3", "value3")
+		assert.Nil(c.GetValue("key2"))
+		assert.Equal("value1", c.GetValue("key1"))
+		assert.Equal("value3", c.GetValue("key3"))
+		assert.EqualValues(1, c.Stats().Evictions)
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		c := NewCacheWithConfig(Config{
+			MaxBytes: 10,
+			SizeOf:   func(_ string, value interface{}) int64 { return int64(len(value.(string))) },
+		})
+		assert := ast.New(t)
+
+		c.Set("key1", "12345")
+		c.Set("key2", "12345")
+		assert.EqualValues(10, c.Stats().Bytes)
+
+		c.Set("key3", "1")
+		assert.Nil(c.GetValue("key1"))
+		assert.Equal("12345", c.GetValue("key2"))
+
+		// Replacing a value updates the size
+		c.Set("key2", "1")
+		assert.EqualValues(2, c.Stats().Bytes)
+		assert.Equal(2, c.Stats().Entries)
+	})
+}
+
 func BenchmarkGet(b *testing.B) {
 	c := NewCache()
 	nbKeys := 100
@@ -0,0 +1,541 @@
+package gdrive // nolint: golint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// CacheStore persists the folder listings and the position in the changes of Google Drive, so that a restarted
+// driver starts with a warm cache. The persisted listings don't expire: they are brought up to date by following the
+// changes made since the saved position (see GDriver.WatchChanges).
+type CacheStore interface {
+	// GetListing returns the persisted listing of a folder, if there's one
+	GetListing(folderID string) ([]*drive.File, bool, error)
+
+	// SetListing persists the listing of a folder
+	SetListing(folderID string, files []*drive.File) error
+
+	// DeleteListings removes the persisted listings of some folders
+	DeleteListings(folderIDs ...string) error
+
+	// FoldersOf returns the folders whose persisted listings contain a file
+	FoldersOf(fileID string) ([]string, error)
+
+	// GetPageToken returns the persisted position in the changes, or "" if there's none
+	GetPageToken() (string, error)
+
+	// SetPageToken persists the position in the changes
+	SetPageToken(token string) error
+
+	// Reset removes everything that was persisted
+	Reset() error
+}
+
+// diskCacheLogName is the name of the log of the DiskCacheStore
+const diskCacheLogName = "gdrive-cache.log"
+
+// diskCacheCompactMinRecords is the number of appended records after which the log can be compacted
+const diskCacheCompactMinRecords = 1000
+
+// diskCacheRecord is a record of the log of the DiskCacheStore
+type diskCacheRecord struct {
+	Folder    string        `json:"folder,omitempty"`    // Folder is the folder whose listing is set or deleted
+	Files     []*drive.File `json:"files,omitempty"`     // Files are the children of the folder
+	Changed   []*drive.File `json:"changed,omitempty"`   // Changed are the children added or changed since the listing
+	Removed   []string      `json:"removed,omitempty"`   // Removed are the IDs of the children removed since the listing
+	Deleted   bool          `json:"deleted,omitempty"`   // Deleted is set when the listing of the folder is removed
+	PageToken string        `json:"pageToken,omitempty"` // PageToken is the position in the changes
+	Reset     bool          `json:"reset,omitempty"`     // Reset is set when everything is removed
+}
+
+// DiskCacheStore is a CacheStore keeping its data in an append-only log in a directory. The log is replayed when the
+// store is opened, and compacted when it contains too many outdated records. When a few children of a folder change,
+// only those are added to the log instead of its whole listing.
+type DiskCacheStore struct {
+	mutex     sync.Mutex
+	path      string                         // path is the path of the log
+	file      *os.File                       // file is the log, opened for appending
+	listings  map[string][]*drive.File       // listings are the listings, by folder ID
+	folders   map[string]map[string]struct{} // folders are the folders containing each file, by file ID
+	pageToken string                         // pageToken is the position in the changes
+	records   int                            // records is the number of records of the log
+}
+
+// NewDiskCacheStore opens the store kept in a directory, it's created if it doesn't exist
+func NewDiskCacheStore(directory string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("couldn't create the cache directory: %w", err)
+	}
+
+	s := &DiskCacheStore{
+		path:     filepath.Join(directory, diskCacheLogName),
+		listings: make(map[string][]*drive.File),
+		folders:  make(map[string]map[string]struct{}),
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// replay loads the records of the log
+func (s *DiskCacheStore) replay() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("couldn't open the cache log: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+
+	for {
+		var record diskCacheRecord
+
+		// The last record might be incomplete if the process was killed while writing it, it's ignored like the
+		// ones that could follow it
+		if err := decoder.Decode(&record); err != nil {
+			return nil
+		}
+
+		s.apply(&record)
+	}
+}
+
+// apply applies a record to the state of the store
+func (s *DiskCacheStore) apply(record *diskCacheRecord) {
+	switch {
+	case record.Reset:
+		s.listings = make(map[string][]*drive.File)
+		s.folders = make(map[string]map[string]struct{})
+		s.pageToken = ""
+	case record.PageToken != "":
+		s.pageToken = record.PageToken
+	case record.Folder != "" && (len(record.Changed) > 0 || len(record.Removed) > 0):
+		s.patchListing(record.Folder, record.Changed, record.Removed)
+	case record.Folder != "":
+		s.removeListing(record.Folder)
+
+		if !record.Deleted {
+			s.addListing(record.Folder, record.Files)
+		}
+	}
+}
+
+// patchListing applies the children that changed to the listing of a folder, which stays sorted by name
+func (s *DiskCacheStore) patchListing(folderID string, changed []*drive.File, removed []string) {
+	replaced := make(map[string]bool, len(changed)+len(removed))
+
+	for _, id := range removed {
+		replaced[id] = true
+	}
+
+	for _, f := range changed {
+		replaced[f.Id] = true
+	}
+
+	files := make([]*drive.File, 0, len(s.listings[folderID])+len(changed))
+
+	for _, f := range s.listings[folderID] {
+		if !replaced[f.Id] {
+			files = append(files, f)
+		}
+	}
+
+	files = append(files, changed...)
+	sort.SliceStable(files, func(i, j int) bool { return lessByName(files[i], files[j]) })
+
+	s.removeListing(folderID)
+	s.addListing(folderID, files)
+}
+
+// listingRecord returns the record setting the listing of a folder. It only has the children that changed since the
+// current listing unless most of them did, and it's nil if none did.
+func (s *DiskCacheStore) listingRecord(folderID string, files []*drive.File) *diskCacheRecord {
+	previous, ok := s.listings[folderID]
+	if !ok {
+		return &diskCacheRecord{Folder: folderID, Files: files}
+	}
+
+	// The children that didn't change are the same instances, the listings are copied when they're updated
+	unchanged := make(map[string]*drive.File, len(previous))
+	for _, f := range previous {
+		unchanged[f.Id] = f
+	}
+
+	record := &diskCacheRecord{Folder: folderID}
+	kept := make(map[string]bool, len(files))
+
+	for _, f := range files {
+		kept[f.Id] = true
+
+		if unchanged[f.Id] != f {
+			record.Changed = append(record.Changed, f)
+		}
+	}
+
+	for _, f := range previous {
+		if !kept[f.Id] {
+			record.Removed = append(record.Removed, f.Id)
+		}
+	}
+
+	switch changes := len(record.Changed) + len(record.Removed); {
+	case changes == 0:
+		return nil
+	case 2*changes > len(files):
+		return &diskCacheRecord{Folder: folderID, Files: files}
+	default:
+		return record
+	}
+}
+
+func (s *DiskCacheStore) addListing(folderID string, files []*drive.File) {
+	s.listings[folderID] = files
+
+	for _, f := range files {
+		if s.folders[f.Id] == nil {
+			s.folders[f.Id] = make(map[string]struct{})
+		}
+
+		s.folders[f.Id][folderID] = struct{}{}
+	}
+}
+
+func (s *DiskCacheStore) removeListing(folderID string) {
+	for _, f := range s.listings[folderID] {
+		delete(s.folders[f.Id], folderID)
+
+		if len(s.folders[f.Id]) == 0 {
+			delete(s.folders, f.Id)
+		}
+	}
+
+	delete(s.listings, folderID)
+}
+
+// compact rewrites the log with only the current state, and opens it for appending
+func (s *DiskCacheStore) compact() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("couldn't close the cache log: %w", err)
+		}
+
+		s.file = nil
+	}
+
+	tmpPath := s.path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't create the cache log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	records := 0
+
+	for folderID, files := range s.listings {
+		if err = encoder.Encode(&diskCacheRecord{Folder: folderID, Files: files}); err != nil {
+			break
+		}
+
+		records++
+	}
+
+	if err == nil && s.pageToken != "" {
+		err = encoder.Encode(&diskCacheRecord{PageToken: s.pageToken})
+		records++
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("couldn't write the cache log: %w", err)
+	}
+
+	if s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		return fmt.Errorf("couldn't open the cache log: %w", err)
+	}
+
+	s.records = records
+
+	return nil
+}
+
+// append applies a record and adds it to the log
+func (s *DiskCacheStore) append(record *diskCacheRecord) error {
+	if s.file == nil {
+		return ErrCacheStoreClosed
+	}
+
+	s.apply(record)
+
+	return s.write(record)
+}
+
+// write adds a record to the log, and compacts it if it has too many records
+func (s *DiskCacheStore) write(record *diskCacheRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("couldn't write the cache log: %w", err)
+	}
+
+	s.records++
+
+	if s.records > diskCacheCompactMinRecords && s.records > 2*(len(s.listings)+1) {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// GetListing returns the persisted listing of a folder, if there's one
+func (s *DiskCacheStore) GetListing(folderID string) ([]*drive.File, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, ok := s.listings[folderID]
+
+	return files, ok, nil
+}
+
+// SetListing persists the listing of a folder
+func (s *DiskCacheStore) SetListing(folderID string, files []*drive.File) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return ErrCacheStoreClosed
+	}
+
+	record := s.listingRecord(folderID, files)
+	if record == nil {
+		return nil
+	}
+
+	// The listing is set as is, the records with the children that changed are only applied when replaying the log
+	s.removeListing(folderID)
+	s.addListing(folderID, files)
+
+	return s.write(record)
+}
+
+// DeleteListings removes the persisted listings of some folders
+func (s *DiskCacheStore) DeleteListings(folderIDs ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, folderID := range folderIDs {
+		if _, ok := s.listings[folderID]; !ok {
+			continue
+		}
+
+		if err := s.append(&diskCacheRecord{Folder: folderID, Deleted: true}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FoldersOf returns the folders whose persisted listings contain a file
+func (s *DiskCacheStore) FoldersOf(fileID string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	folders := make([]string, 0, len(s.folders[fileID]))
+	for folderID := range s.folders[fileID] {
+		folders = append(folders, folderID)
+	}
+
+	return folders, nil
+}
+
+// GetPageToken returns the persisted position in the changes, or "" if there's none
+func (s *DiskCacheStore) GetPageToken() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.pageToken, nil
+}
+
+// SetPageToken persists the position in the changes
+func (s *DiskCacheStore) SetPageToken(token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if token == s.pageToken {
+		return nil
+	}
+
+	return s.append(&diskCacheRecord{PageToken: token})
+}
+
+// Reset removes everything that was persisted
+func (s *DiskCacheStore) Reset() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.append(&diskCacheRecord{Reset: true})
+}
+
+// Close flushes the log to the disk and closes it
+func (s *DiskCacheStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Sync()
+	if errClose := s.file.Close(); err == nil {
+		err = errClose
+	}
+
+	s.file = nil
+
+	return err
+}
+
+// loadListing loads the persisted listing of a folder into the cache, the listings lock has to be held
+func (a *APIWrapper) loadListing(folderID string) *folderListing {
+	if a.store == nil || !a.UseCache {
+		return nil
+	}
+
+	files, ok, err := a.store.GetListing(folderID)
+	if err != nil {
+		a.logger.Warn("Couldn't load a persisted listing", "folderId", folderID, "err", err)
+		return nil
+	}
+
+	if !ok {
+		return nil
+	}
+
+	listing := newFolderListing(files)
+	a.cache.SetTagged(listingKey(folderID), listing, fileIDs(listing.files)...)
+
+	return listing
+}
+
+// persistListing persists the listing of a folder, the listings lock has to be held
+func (a *APIWrapper) persistListing(folderID string, files []*drive.File) {
+	if a.store == nil {
+		return
+	}
+
+	if err := a.store.SetListing(folderID, files); err != nil {
+		a.logger.Warn("Couldn't persist a listing", "folderId", folderID, "err", err)
+	}
+}
+
+// deletePersistedListings removes the persisted listings of some folders
+func (a *APIWrapper) deletePersistedListings(folderIDs ...string) {
+	if a.store == nil || len(folderIDs) == 0 {
+		return
+	}
+
+	a.listings.mutex.Lock()
+	defer a.listings.mutex.Unlock()
+
+	a.listings.generation++
+
+	if err := a.store.DeleteListings(folderIDs...); err != nil {
+		a.logger.Warn("Couldn't remove some persisted listings", "err", err)
+	}
+}
+
+// persistedFoldersOf returns the folders whose persisted listings contain a file
+func (a *APIWrapper) persistedFoldersOf(fileID string) []string {
+	if a.store == nil {
+		return nil
+	}
+
+	folders, err := a.store.FoldersOf(fileID)
+	if err != nil {
+		a.logger.Warn("Couldn't find the persisted listings of a file", "fileId", fileID, "err", err)
+	}
+
+	return folders
+}
+
+// persistPageToken persists the position in the changes
+func (a *APIWrapper) persistPageToken(token string) {
+	if a.store == nil {
+		return
+	}
+
+	if err := a.store.SetPageToken(token); err != nil {
+		a.logger.Warn("Couldn't persist the changes position", "err", err)
+	}
+}
+
+// resetCache removes all the cached and persisted lookups
+func (a *APIWrapper) resetCache() {
+	a.listings.mutex.Lock()
+	defer a.listings.mutex.Unlock()
+
+	a.listings.generation++
+	a.cache.CleanupEverything()
+
+	if a.store == nil {
+		return
+	}
+
+	if err := a.store.Reset(); err != nil {
+		a.logger.Warn("Couldn't reset the persisted lookups", "err", err)
+	}
+}
+
+// persistedListingHas returns true if the persisted listing of a folder has the current version of a file
+func (a *APIWrapper) persistedListingHas(folderID string, file *drive.File) bool {
+	if a.store == nil {
+		return false
+	}
+
+	files, ok, err := a.store.GetListing(folderID)
+	if err != nil || !ok {
+		return false
+	}
+
+	return hasVersion(files, file)
+}
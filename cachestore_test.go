@@ -0,0 +1,187 @@
+package gdrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestDiskCacheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdrive-cache")
+	require.NoError(t, err)
+
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store, err := NewDiskCacheStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetListing("folder1", []*drive.File{{Id: "file1", Name: "File1", Size: 12}}))
+	require.NoError(t, store.SetListing("folder2", []*drive.File{{Id: "file1", Name: "File1"}}))
+	require.NoError(t, store.SetListing("folder3", nil))
+	require.NoError(t, store.DeleteListings("folder2"))
+	require.NoError(t, store.SetPageToken("42"))
+	require.NoError(t, store.Close())
+
+	// A record that was only partially written
+	log, err := os.OpenFile(filepath.Join(dir, diskCacheLogName), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = log.WriteString(`{"folder":"folder4","fil`)
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	store, err = NewDiskCacheStore(dir)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, store.Close()) }()
+
+	files, ok, err := store.GetListing("folder1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, files, 1)
+	require.Equal(t, "File1", files[0].Name)
+	require.EqualValues(t, 12, files[0].Size)
+
+	_, ok, err = store.GetListing("folder2")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = store.GetListing("folder3")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = store.GetListing("folder4")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	folders, err := store.FoldersOf("file1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"folder1"}, folders)
+
+	token, err := store.GetPageToken()
+	require.NoError(t, err)
+	require.Equal(t, "42", token)
+
+	require.NoError(t, store.Reset())
+
+	_, ok, err = store.GetListing("folder1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	token, err = store.GetPageToken()
+	require.NoError(t, err)
+	require.Empty(t, token)
+}
+
+func TestDiskCacheStoreChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdrive-cache")
+	require.NoError(t, err)
+
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store, err := NewDiskCacheStore(dir)
+	require.NoError(t, err)
+
+	// The files are added one at a time, like when they're uploaded
+	var files []*drive.File
+
+	for i := 0; i < 100; i++ {
+		file := &drive.File{Id: fmt.Sprintf("file%03d", i), Name: fmt.Sprintf("File%03d", i)}
+		files = append(append([]*drive.File(nil), files...), file)
+		require.NoError(t, store.SetListing("folder1", files))
+	}
+
+	files = append([]*drive.File(nil), files[1:]...)
+	files[0] = &drive.File{Id: "file001", Name: "File001b"}
+	require.NoError(t, store.SetListing("folder1", files))
+	require.NoError(t, store.Close())
+
+	// Only the first record has the whole listing
+	data, err := ioutil.ReadFile(filepath.Join(dir, diskCacheLogName))
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 101)
+
+	for _, line := range lines[1:] {
+		var record diskCacheRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		require.Empty(t, record.Files)
+		require.Len(t, record.Changed, 1)
+	}
+
+	store, err = NewDiskCacheStore(dir)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, store.Close()) }()
+
+	replayed, ok, err := store.GetListing("folder1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, files, replayed)
+
+	folders, err := store.FoldersOf("file000")
+	require.NoError(t, err)
+	require.Empty(t, folders)
+}
+
+func TestPersistentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdrive-cache")
+	require.NoError(t, err)
+
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// A first run
+	store, err := NewDiskCacheStore(dir)
+	require.NoError(t, err)
+
+	driver, server := setupFake(t, PersistentCache(store))
+
+	watcher, err := driver.WatchChanges(0, nil)
+	require.NoError(t, err)
+
+	mustWriteFile(t, driver, "Folder1/File1")
+	mustWriteFile(t, driver, "Folder2/File2")
+	require.NoError(t, getError(driver.Stat("Folder1/File1")))
+	require.NoError(t, getError(driver.Stat("Folder2/File2")))
+	require.NoError(t, watcher.Poll())
+
+	watcher.Stop()
+	require.NoError(t, store.Close())
+
+	// A change made while we're stopped
+	other := reopen(t, server, driver)
+	require.NoError(t, other.Rename("Folder1/File1", "Folder1/File3"))
+
+	// The next run
+	store, err = NewDiskCacheStore(dir)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, store.Close()) }()
+
+	driver = reopen(t, server, driver, PersistentCache(store))
+
+	watcher, err = driver.WatchChanges(0, nil)
+	require.NoError(t, err)
+
+	defer watcher.Stop()
+
+	listCalls := func() int32 {
+		return atomic.LoadInt32(driver.srvWrapper.calls["Files.List"])
+	}
+
+	// The folders that weren't changed don't have to be listed again
+	require.NoError(t, getError(driver.Stat("Folder2/File2")))
+	require.Zero(t, listCalls())
+
+	require.True(t, IsNotExist(getError(driver.Stat("Folder1/File1"))))
+	require.NoError(t, getError(driver.Stat("Folder1/File3")))
+	require.EqualValues(t, 1, listCalls())
+}
@@ -0,0 +1,180 @@
+package gdrive // nolint: golint
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// changesListPageSize is the maximum page size allowed by Changes.List
+const changesListPageSize = 1000
+
+// changeFields are the fields fetched for each change
+var changeFields = googleapi.Field(
+	"nextPageToken,newStartPageToken," +
+		"changes(changeType,driveId,fileId,removed,time,file(id,mimeType,modifiedTime,name,parents,size,trashed))",
+)
+
+// ChangeWatcher follows the changes made on Google Drive, by this process or any other client, and evicts the cached
+// lookups they affect
+type ChangeWatcher struct {
+	driver    *GDriver                      // driver is the driver whose cache is updated, bound to the watcher context
+	callback  func(changes []*drive.Change) // callback is called with each batch of changes, if not nil
+	pageToken string                        // pageToken is the token of the next changes to pull
+	mutex     sync.Mutex                    // mutex prevents concurrent pulls
+	cancel    context.CancelFunc            // cancel stops the watcher
+	done      chan struct{}                 // done is closed once the background polling stopped
+}
+
+// WatchChanges starts following the changes made on Google Drive. They are pulled every interval, or only when Poll
+// is called if interval isn't positive (like when a push notification channel is used). The callback, if not nil,
+// is called with each batch of changes once the cache was updated.
+// With the PersistentCache option, the watcher resumes from the position saved by the previous one: the changes made
+// meanwhile are pulled before it's returned.
+func (d *GDriver) WatchChanges(interval time.Duration, callback func(changes []*drive.Change)) (*ChangeWatcher, error) {
+	ctx, cancel := context.WithCancel(d.Context())
+
+	w := &ChangeWatcher{
+		driver:   d.WithContext(ctx),
+		callback: callback,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	if err := w.resume(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if interval > 0 {
+		go w.run(ctx, interval)
+	} else {
+		close(w.done)
+	}
+
+	return w, nil
+}
+
+// resume sets the position of the watcher, from the persisted position if there's one
+func (w *ChangeWatcher) resume() error {
+	store := w.driver.srvWrapper.store
+
+	if store != nil {
+		token, err := store.GetPageToken()
+		if err != nil {
+			w.driver.Logger.Warn("Couldn't load the persisted changes position", "err", err)
+		}
+
+		if token != "" {
+			w.pageToken = token
+
+			if err = w.Poll(); err == nil {
+				return nil
+			}
+
+			// The position might have expired, the persisted listings can't be trusted anymore
+			w.driver.Logger.Warn("Couldn't pull the changes since the persisted position", "err", err)
+			w.driver.srvWrapper.resetCache()
+		}
+	}
+
+	var token *drive.StartPageToken
+
+	err := w.driver.callAPI(CallRead, true, func() error {
+		var err error
+		token, err = w.driver.srv.Changes.GetStartPageToken().
+			SupportsAllDrives(true).
+			Context(w.driver.Context()).
+			Do()
+
+		return err
+	})
+	if err != nil {
+		return &DriveAPICallError{Err: err}
+	}
+
+	// The listings persisted before this position can't be brought up to date
+	if store != nil {
+		if err := store.Reset(); err != nil {
+			w.driver.Logger.Warn("Couldn't reset the persisted lookups", "err", err)
+		}
+	}
+
+	w.pageToken = token.StartPageToken
+	w.driver.srvWrapper.persistPageToken(w.pageToken)
+
+	return nil
+}
+
+func (w *ChangeWatcher) run(ctx context.Context, interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Poll(); err != nil && ctx.Err() == nil {
+				w.driver.Logger.Warn("Couldn't pull the changes", "err", err)
+			}
+		}
+	}
+}
+
+// Poll pulls the changes that happened since the last pull and updates the cache accordingly
+func (w *ChangeWatcher) Poll() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	d := w.driver
+
+	for {
+		call := d.srv.Changes.List(w.pageToken).
+			Fields(changeFields).
+			PageSize(changesListPageSize).
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true)
+
+		var list *drive.ChangeList
+
+		err := d.callAPI(CallRead, true, func() error {
+			var err error
+			list, err = call.Context(d.Context()).Do()
+
+			return err
+		})
+		if err != nil {
+			return &DriveAPICallError{Err: err}
+		}
+
+		for _, change := range list.Changes {
+			d.srvWrapper.applyChange(change)
+		}
+
+		if w.callback != nil && len(list.Changes) > 0 {
+			w.callback(list.Changes)
+		}
+
+		if list.NextPageToken == "" {
+			w.pageToken = list.NewStartPageToken
+			d.srvWrapper.persistPageToken(w.pageToken)
+
+			return nil
+		}
+
+		w.pageToken = list.NextPageToken
+		d.srvWrapper.persistPageToken(w.pageToken)
+	}
+}
+
+// Stop stops the watcher, and waits for the background polling to end
+func (w *ChangeWatcher) Stop() {
+	w.cancel()
+	<-w.done
+}
@@ -0,0 +1,66 @@
+package gdrive
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestWatchChanges(t *testing.T) {
+	driver, server := setupFake(t)
+
+	// Another client, with its own cache
+	other := reopen(t, server, driver)
+
+	mustWriteFile(t, driver, "Folder1/File1")
+
+	var received int32
+
+	watcher, err := driver.WatchChanges(0, func(changes []*drive.Change) {
+		atomic.AddInt32(&received, int32(len(changes)))
+	})
+	require.NoError(t, err)
+
+	t.Run("poll", func(t *testing.T) {
+		require.NoError(t, getError(driver.Stat("Folder1")))
+		require.NoError(t, getError(driver.Stat("Folder1/File1")))
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File3"))))
+
+		require.NoError(t, other.Rename("Folder1/File1", "Folder1/File2"))
+		mustWriteFile(t, other, "Folder1/File3")
+
+		// Our lookups are stale
+		require.NoError(t, getError(driver.Stat("Folder1/File1")))
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File3"))))
+
+		require.NoError(t, watcher.Poll())
+		require.NotZero(t, atomic.LoadInt32(&received))
+
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File1"))))
+		require.NoError(t, getError(driver.Stat("Folder1/File2")))
+		require.NoError(t, getError(driver.Stat("Folder1/File3")))
+
+		// The lookups that weren't affected are still cached
+		calls := driver.srvWrapper.TotalNbCalls()
+		require.NoError(t, getError(driver.Stat("Folder1")))
+		require.Equal(t, calls, driver.srvWrapper.TotalNbCalls())
+	})
+
+	t.Run("background", func(t *testing.T) {
+		watcher, err := driver.WatchChanges(10*time.Millisecond, nil)
+		require.NoError(t, err)
+
+		defer watcher.Stop()
+
+		require.NoError(t, other.Remove("Folder1/File2"))
+
+		require.Eventually(t, func() bool {
+			return IsNotExist(getError(driver.Stat("Folder1/File2")))
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	watcher.Stop()
+}
@@ -0,0 +1,242 @@
+package gdrive // nolint: golint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/api/drive/v3"
+
+	"github.com/jonny5532/afero-gdrive/blockcache"
+)
+
+// DefaultContentBlockSize is the size of the blocks of the content cache used by default
+const DefaultContentBlockSize = 1 << 20
+
+// contentKey returns the key of the content of a file in the content cache, it changes with each version of the file
+func contentKey(file *drive.File) string {
+	version := file.Md5Checksum
+	if version == "" {
+		version = file.ModifiedTime
+	}
+
+	return fmt.Sprintf("%s-%s-%d", file.Id, version, file.Size)
+}
+
+// ContentCacheStats returns the counters of the content cache, if it's enabled
+func (d *GDriver) ContentCacheStats() blockcache.Stats {
+	if d.contentCache == nil {
+		return blockcache.Stats{}
+	}
+
+	return d.contentCache.Stats()
+}
+
+// cachesContent returns true if the content of a file goes through the content cache. The exported documents don't,
+// as their size isn't known before they're exported.
+func (d *GDriver) cachesContent(fi *FileInfo) bool {
+	return d.contentCache != nil && fi.export == nil && !fi.IsDir() && !isGoogleDoc(fi.file)
+}
+
+// openReader opens a reader of the content of a file from an offset, through the content cache if it's enabled.
+// Without it, the download is opened right away so that the errors are returned by the opening.
+func (d *GDriver) openReader(fi *FileInfo, offset int64) (io.ReadCloser, error) {
+	if d.cachesContent(fi) {
+		return d.newCachedReader(fi, offset), nil
+	}
+
+	// The parallel downloads start right away
+	if reader := d.newStreamReader(fi, offset); reader.parallel {
+		reader.prefetch()
+		return reader, nil
+	}
+
+	stream, err := d.getFileReader(fi, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := d.newStreamReader(fi, offset)
+	reader.stream, reader.streamOffset = stream, offset
+
+	return reader, nil
+}
+
+// cachedReader reads the content of a file by blocks, from the content cache or from Google Drive. The missing
+// blocks read sequentially are fetched with a single download, that is kept open while they're read.
+type cachedReader struct {
+	driver       *GDriver
+	fi           *FileInfo
+	key          string        // key is the key of the version of the file in the content cache
+	blockSize    int64         // blockSize is the size of the blocks
+	offset       int64         // offset is the position of the next read
+	stream       io.ReadCloser // stream is the current download, if any
+	streamOffset int64         // streamOffset is the position of the download
+}
+
+func (d *GDriver) newCachedReader(fi *FileInfo, offset int64) *cachedReader {
+	blockSize := d.ContentBlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultContentBlockSize
+	}
+
+	return &cachedReader{
+		driver:    d,
+		fi:        fi,
+		key:       contentKey(fi.file),
+		blockSize: blockSize,
+		offset:    offset,
+	}
+}
+
+// seek moves the position of the next read
+func (r *cachedReader) seek(offset int64) {
+	r.offset = offset
+}
+
+// Read reads from the current offset
+func (r *cachedReader) Read(p []byte) (int, error) {
+	n, err := r.read(p, r.offset, true)
+	r.offset += int64(n)
+
+	return n, err
+}
+
+// ReadAt reads from an offset, without changing the current one. The missing blocks are fetched with ranged downloads.
+func (r *cachedReader) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+
+	for read < len(p) {
+		n, err := r.read(p[read:], off+int64(read), false)
+		read += n
+
+		if err != nil {
+			return read, err
+		}
+	}
+
+	return read, nil
+}
+
+// read reads from a block
+func (r *cachedReader) read(p []byte, offset int64, sequential bool) (int, error) {
+	size := r.fi.file.Size
+
+	if offset >= size {
+		return 0, io.EOF
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	index := offset / r.blockSize
+
+	block, err := r.block(index, sequential)
+	if err != nil {
+		return 0, err
+	}
+
+	within := offset - index*r.blockSize
+	if within >= int64(len(block)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return copy(p, block[within:]), nil
+}
+
+// block returns a block, from the content cache or from Google Drive
+func (r *cachedReader) block(index int64, sequential bool) ([]byte, error) {
+	if data, ok := r.driver.contentCache.Get(r.key, index); ok {
+		return data, nil
+	}
+
+	start := index * r.blockSize
+	length := r.blockSize
+
+	if remaining := r.fi.file.Size - start; remaining < length {
+		length = remaining
+	}
+
+	data := make([]byte, length)
+
+	var err error
+
+	if sequential {
+		err = r.readStream(data, start)
+	} else {
+		err = r.readRange(data, start)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.driver.contentCache.Set(r.key, index, data); err != nil {
+		r.driver.Logger.Warn("Couldn't cache a block", "fileId", r.fi.file.Id, "block", index, "err", err)
+	}
+
+	return data, nil
+}
+
+// readStream reads some data from the download, which is (re-)opened if it isn't at the right position
+func (r *cachedReader) readStream(data []byte, start int64) error {
+	if r.stream != nil && r.streamOffset != start {
+		r.closeStream()
+	}
+
+	if r.stream == nil {
+		stream, err := r.driver.getFileReader(r.fi, start)
+		if err != nil {
+			return err
+		}
+
+		r.stream, r.streamOffset = stream, start
+	}
+
+	n, err := io.ReadFull(r.stream, data)
+	r.streamOffset += int64(n)
+
+	if err != nil {
+		r.closeStream()
+		return unexpectedEOF(err)
+	}
+
+	return nil
+}
+
+// readRange reads some data with a ranged download
+func (r *cachedReader) readRange(data []byte, start int64) error {
+	reader, err := r.driver.getFileRangeReader(r.fi, start, start+int64(len(data))-1)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = reader.Close() }()
+
+	_, err = io.ReadFull(reader, data)
+
+	return unexpectedEOF(err)
+}
+
+// unexpectedEOF reports a content shorter than its announced size as an unexpected end
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func (r *cachedReader) closeStream() {
+	if r.stream != nil {
+		_ = r.stream.Close()
+		r.stream = nil
+	}
+}
+
+// Close closes the download, if any
+func (r *cachedReader) Close() error {
+	r.closeStream()
+	return nil
+}
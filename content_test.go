@@ -0,0 +1,99 @@
+package gdrive
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// downloadCounter counts the downloads of file contents
+type downloadCounter struct {
+	base      http.RoundTripper
+	downloads int32
+}
+
+func (c *downloadCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet && req.URL.Query().Get("alt") == "media" {
+		atomic.AddInt32(&c.downloads, 1)
+	}
+
+	return c.base.RoundTrip(req)
+}
+
+func (c *downloadCounter) count() int32 {
+	return atomic.LoadInt32(&c.downloads)
+}
+
+// countDownloads starts counting the downloads of a driver
+func countDownloads(driver *GDriver) *downloadCounter {
+	counter := &downloadCounter{base: driver.client.Transport}
+	driver.client.Transport = counter
+
+	return counter
+}
+
+func TestContentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdrive-content")
+	require.NoError(t, err)
+
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	driver := setup(t, ContentCache(dir, 0, 4))
+	counter := countDownloads(driver)
+
+	content := "Hello World, from the cache"
+	mustWriteFileContent(t, driver, "File1", content)
+
+	// The first read fetches the content with a single download
+	mustReadFileContent(t, driver, "File1", content)
+	require.EqualValues(t, 1, counter.count())
+
+	stats := driver.ContentCacheStats()
+	require.Equal(t, 7, stats.Blocks)
+	require.EqualValues(t, len(content), stats.Bytes)
+
+	// The next ones are served from the cache
+	mustReadFileContent(t, driver, "File1", content)
+
+	file, err := driver.Open("File1")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, file.Close()) }()
+
+	buffer := make([]byte, 5)
+	_, err = file.ReadAt(buffer, 6)
+	require.NoError(t, err)
+	require.Equal(t, "World", string(buffer))
+
+	_, err = file.Seek(13, io.SeekStart)
+	require.NoError(t, err)
+
+	rest, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	require.Equal(t, content[13:], string(rest))
+	require.EqualValues(t, 1, counter.count())
+
+	// A new version of the file is fetched again, by ranged downloads for the random reads
+	content = strings.ToUpper(content)
+	mustWriteFileContent(t, driver, "File1", content)
+
+	other, err := driver.Open("File1")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, other.Close()) }()
+
+	_, err = other.ReadAt(buffer, 6)
+	require.NoError(t, err)
+	require.Equal(t, "WORLD", string(buffer))
+	require.EqualValues(t, 3, counter.count())
+
+	_, err = other.ReadAt(buffer, 22)
+	require.NoError(t, err)
+	require.Equal(t, "CACHE", string(buffer))
+}
@@ -0,0 +1,124 @@
+package drivetest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultChangesList = "kind,nextPageToken,newStartPageToken," +
+		"changes(kind,changeType,time,removed,fileId,driveId,file(kind,id,name,mimeType))"
+
+	defaultChangesPageSize = 100
+	maxChangesPageSize     = 1000
+)
+
+// change is an entry of the changes log. Like on Google Drive, the changes only reference the files: their latest
+// state is returned when they are listed.
+type change struct {
+	fileID  string // fileID is the ID of the file that changed
+	driveID string // driveID is the ID of the shared drive that changed, for the changes of shared drives
+	time    string // time is the time of the change
+}
+
+// recordChange adds the change of a file to the changes log
+func (s *Server) recordChange(fileID string) {
+	s.changes = append(s.changes, change{fileID: fileID, time: now()})
+}
+
+// recordDriveChange adds the change of a shared drive to the changes log
+func (s *Server) recordDriveChange(driveID string) {
+	s.changes = append(s.changes, change{driveID: driveID, time: now()})
+}
+
+func (s *Server) serveChanges(w http.ResponseWriter, r *http.Request, parts []string) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.listChanges(w, r)
+	case len(parts) == 2 && parts[1] == "startPageToken":
+		// Page tokens are simply the position in the changes log
+		writeJSON(w, r, map[string]interface{}{
+			"kind":           "drive#startPageToken",
+			"startPageToken": strconv.Itoa(len(s.changes)),
+		}, "kind,startPageToken")
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) listChanges(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.Atoi(r.Form.Get("pageToken"))
+	if err != nil || offset < 0 || offset > len(s.changes) {
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page token: %s", r.Form.Get("pageToken")))
+		return
+	}
+
+	pageSize := defaultChangesPageSize
+	if v := r.Form.Get("pageSize"); v != "" {
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page size: %s", v))
+			return
+		}
+
+		if pageSize > maxChangesPageSize {
+			pageSize = maxChangesPageSize
+		}
+	}
+
+	allDrives := r.Form.Get("includeItemsFromAllDrives") == "true"
+	list := map[string]interface{}{"kind": "drive#changeList"}
+	changes := make([]interface{}, 0)
+
+	end := offset + pageSize
+	if end < len(s.changes) {
+		list["nextPageToken"] = strconv.Itoa(end)
+	} else {
+		end = len(s.changes)
+		list["newStartPageToken"] = strconv.Itoa(end)
+	}
+
+	for _, c := range s.changes[offset:end] {
+		value := map[string]interface{}{"kind": "drive#change", "time": c.time}
+
+		if c.driveID != "" {
+			value["changeType"] = "drive"
+			value["driveId"] = c.driveID
+
+			if d, ok := s.drives[c.driveID]; ok {
+				value["drive"] = d
+			} else {
+				value["removed"] = true
+			}
+
+			changes = append(changes, value)
+
+			continue
+		}
+
+		value["changeType"] = "file"
+		value["fileId"] = c.fileID
+
+		if n, ok := s.nodes[c.fileID]; ok {
+			if n.file.DriveId != "" && !allDrives {
+				continue
+			}
+
+			value["file"] = n.value()
+		} else {
+			value["removed"] = true
+		}
+
+		changes = append(changes, value)
+	}
+
+	list["changes"] = changes
+
+	writeJSON(w, r, list, defaultChangesList)
+}
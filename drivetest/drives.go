@@ -0,0 +1,145 @@
+package drivetest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	defaultDriveFields = "kind,id,name"
+	defaultDrivesList  = "kind,nextPageToken,drives(kind,id,name)"
+
+	defaultDrivesPageSize = 10
+	maxDrivesPageSize     = 100
+)
+
+func (s *Server) serveDrives(w http.ResponseWriter, r *http.Request, parts []string) bool {
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.listDrives(w, r)
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.createDrive(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.getDrive(w, r, parts[1])
+	default:
+		return false
+	}
+
+	return true
+}
+
+// createDrive creates a shared drive, and the folder that is its root. Like on Google Drive, this folder has the ID
+// of the drive.
+func (s *Server) createDrive(w http.ResponseWriter, r *http.Request) {
+	if r.Form.Get("requestId") == "" {
+		writeError(w, http.StatusBadRequest, "required", "Required parameter: requestId")
+		return
+	}
+
+	meta, _, ok := s.readMetadata(w, r)
+	if !ok {
+		return
+	}
+
+	root := s.newFile(meta.Name, mimeTypeFolder)
+	root.DriveId = root.Id
+	s.nodes[root.Id] = &node{file: root}
+
+	d := &drive.Drive{
+		Kind:        "drive#drive",
+		Id:          root.Id,
+		Name:        meta.Name,
+		CreatedTime: root.CreatedTime,
+	}
+	s.drives[d.Id] = d
+	s.recordDriveChange(d.Id)
+
+	writeJSON(w, r, d, defaultDriveFields)
+}
+
+func (s *Server) getDrive(w http.ResponseWriter, r *http.Request, id string) {
+	d, ok := s.drives[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Shared drive not found: %s", id))
+		return
+	}
+
+	writeJSON(w, r, d, defaultDriveFields)
+}
+
+func (s *Server) listDrives(w http.ResponseWriter, r *http.Request) {
+	drives := make([]*drive.Drive, 0, len(s.drives))
+	for _, d := range s.drives {
+		drives = append(drives, d)
+	}
+
+	sort.Slice(drives, func(i, j int) bool {
+		return strings.ToLower(drives[i].Name) < strings.ToLower(drives[j].Name)
+	})
+
+	pageSize := defaultDrivesPageSize
+	if v := r.Form.Get("pageSize"); v != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 || pageSize > maxDrivesPageSize {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page size: %s", v))
+			return
+		}
+	}
+
+	offset := 0
+	if v := r.Form.Get("pageToken"); v != "" {
+		var err error
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 || offset > len(drives) {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page token: %s", v))
+			return
+		}
+	}
+
+	list := &drive.DriveList{Kind: "drive#driveList", Drives: drives[offset:]}
+
+	if end := offset + pageSize; end < len(drives) {
+		list.Drives = drives[offset:end]
+		list.NextPageToken = strconv.Itoa(end)
+	}
+
+	writeJSON(w, r, list, defaultDrivesList)
+}
+
+// corpora returns the predicate selecting the files of the corpora of a files listing
+func (s *Server) corpora(r *http.Request) (func(*drive.File) bool, error) {
+	driveID := r.Form.Get("driveId")
+	allDrives := r.Form.Get("includeItemsFromAllDrives") == "true"
+
+	switch r.Form.Get("corpora") {
+	case "", "user":
+		if driveID != "" {
+			return nil, fmt.Errorf("the driveId parameter requires the drive corpora")
+		}
+
+		// The files of the shared drives aren't part of the user corpora
+		return func(f *drive.File) bool { return f.DriveId == "" }, nil
+	case "drive":
+		if driveID == "" || !allDrives {
+			return nil, fmt.Errorf("the drive corpora requires driveId and includeItemsFromAllDrives")
+		}
+
+		if _, ok := s.drives[driveID]; !ok {
+			return nil, fmt.Errorf("shared drive not found: %s", driveID)
+		}
+
+		return func(f *drive.File) bool { return f.DriveId == driveID }, nil
+	case "allDrives":
+		if !allDrives {
+			return nil, fmt.Errorf("the allDrives corpora requires includeItemsFromAllDrives")
+		}
+
+		return func(*drive.File) bool { return true }, nil
+	}
+
+	return nil, fmt.Errorf("unsupported corpora: %s", r.Form.Get("corpora"))
+}
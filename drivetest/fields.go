@@ -0,0 +1,131 @@
+package drivetest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldMask is a parsed "fields" parameter. A nil sub-mask means the whole sub-tree is selected.
+type fieldMask map[string]fieldMask
+
+// parseFields parses a partial response selector like "nextPageToken,files(id,name)"
+func parseFields(s string) (fieldMask, error) {
+	s = strings.ReplaceAll(s, " ", "")
+
+	if s == "" || s == "*" {
+		return nil, nil
+	}
+
+	mask, rest, err := parseFieldList(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("invalid field selection: %s", s)
+	}
+
+	return mask, nil
+}
+
+func parseFieldList(s string) (fieldMask, string, error) {
+	mask := make(fieldMask)
+
+	for {
+		end := strings.IndexAny(s, ",()")
+		if end < 0 {
+			end = len(s)
+		}
+
+		name := s[:end]
+		s = s[end:]
+
+		if name == "" {
+			return nil, s, fmt.Errorf("invalid field selection: empty field name")
+		}
+
+		var sub fieldMask
+
+		if strings.HasPrefix(s, "(") {
+			var err error
+
+			if sub, s, err = parseFieldList(s[1:]); err != nil {
+				return nil, s, err
+			}
+
+			if !strings.HasPrefix(s, ")") {
+				return nil, s, fmt.Errorf("invalid field selection: missing closing parenthesis")
+			}
+
+			s = s[1:]
+		}
+
+		mask.add(strings.Split(name, "/"), sub)
+
+		if !strings.HasPrefix(s, ",") {
+			return mask, s, nil
+		}
+
+		s = s[1:]
+	}
+}
+
+// add adds a (possibly "a/b/c" split) path to the mask
+func (m fieldMask) add(path []string, sub fieldMask) {
+	if len(path) == 1 {
+		if path[0] == "*" {
+			m["*"] = nil
+		} else {
+			m[path[0]] = sub
+		}
+
+		return
+	}
+
+	child, ok := m[path[0]]
+	if ok && child == nil {
+		// The whole sub-tree is already selected
+		return
+	}
+
+	if child == nil {
+		child = make(fieldMask)
+		m[path[0]] = child
+	}
+
+	child.add(path[1:], sub)
+}
+
+// apply filters a generic JSON value (as produced by json.Unmarshal)
+func (m fieldMask) apply(value interface{}) interface{} {
+	if m == nil {
+		return value
+	}
+
+	if _, all := m["*"]; all {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		filtered := make(map[string]interface{})
+
+		for key, sub := range m {
+			if child, ok := v[key]; ok {
+				filtered[key] = sub.apply(child)
+			}
+		}
+
+		return filtered
+	case []interface{}:
+		filtered := make([]interface{}, len(v))
+
+		for i, child := range v {
+			filtered[i] = m.apply(child)
+		}
+
+		return filtered
+	default:
+		return value
+	}
+}
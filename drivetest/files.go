@@ -0,0 +1,725 @@
+package drivetest
+
+import (
+	"crypto/md5"  // nolint: gosec
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	defaultFileFields = "kind,id,name,mimeType"
+	defaultListFields = "kind,nextPageToken,incompleteSearch,files(kind,id,name,mimeType)"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	match, err := parseQuery(r.Form.Get("q"), s.rootID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid Value: %v", err))
+		return
+	}
+
+	inCorpora, err := s.corpora(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid Value: %v", err))
+		return
+	}
+
+	nodes := make([]*node, 0)
+
+	for _, n := range s.nodes {
+		// The root folders aren't listed
+		if n.file.Id != s.rootID && s.drives[n.file.Id] == nil && inCorpora(n.file) && match(n.file) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	sortNodes(nodes, r.Form.Get("orderBy"))
+
+	pageSize := defaultPageSize
+	if v := r.Form.Get("pageSize"); v != "" {
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page size: %s", v))
+			return
+		}
+
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+	}
+
+	// Page tokens are simply the offset of the next page
+	offset := 0
+	if v := r.Form.Get("pageToken"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page token: %s", v))
+			return
+		}
+	}
+
+	files := make([]interface{}, 0)
+	list := map[string]interface{}{"kind": "drive#fileList"}
+
+	if offset < len(nodes) {
+		end := offset + pageSize
+		if end < len(nodes) {
+			list["nextPageToken"] = strconv.Itoa(end)
+		} else {
+			end = len(nodes)
+		}
+
+		for _, n := range nodes[offset:end] {
+			files = append(files, n.value())
+		}
+	}
+
+	list["files"] = files
+
+	writeJSON(w, r, list, defaultListFields)
+}
+
+// sortNodes sorts files following an "orderBy" parameter like "folder,name desc"
+func sortNodes(nodes []*node, orderBy string) {
+	var keys []string
+	if orderBy != "" {
+		keys = strings.Split(orderBy, ",")
+	}
+
+	// We always sort by name and ID to have a stable order
+	keys = append(keys, "name", "id")
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		for _, key := range keys {
+			fields := strings.Fields(key)
+			if len(fields) == 0 {
+				continue
+			}
+
+			c := compareFiles(nodes[i].file, nodes[j].file, fields[0])
+			if len(fields) > 1 && strings.EqualFold(fields[1], "desc") {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return false
+	})
+}
+
+func compareFiles(a, b *drive.File, key string) int {
+	switch key {
+	case "folder":
+		// folders first
+		return compareBool(b.MimeType == mimeTypeFolder, a.MimeType == mimeTypeFolder)
+	case "name", "name_natural":
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case "id":
+		return strings.Compare(a.Id, b.Id)
+	case "modifiedTime", "createdTime", "viewedByMeTime":
+		ta, _ := parseTime(stringField(a, key))
+		tb, _ := parseTime(stringField(b, key))
+
+		switch {
+		case ta.Before(tb):
+			return -1
+		case ta.After(tb):
+			return 1
+		}
+	case "quotaBytesUsed":
+		return compareInt(a.Size, b.Size)
+	}
+
+	return 0
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (s *Server) getFile(w http.ResponseWriter, r *http.Request, id string) {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return
+	}
+
+	if r.Form.Get("alt") == "media" {
+		s.downloadFile(w, r, n)
+		return
+	}
+
+	writeJSON(w, r, n.value(), defaultFileFields)
+}
+
+func (s *Server) downloadFile(w http.ResponseWriter, r *http.Request, n *node) {
+	if strings.HasPrefix(n.file.MimeType, mimeTypeApps) {
+		writeError(
+			w, http.StatusForbidden, "fileNotDownloadable",
+			"Only files with binary content can be downloaded. Use Export with Docs Editors files.",
+		)
+
+		return
+	}
+
+	writeContent(w, r, n.content, n.file.MimeType)
+}
+
+// writeContent writes the content of a file, or the range of it requested by the Range header
+func writeContent(w http.ResponseWriter, r *http.Request, content []byte, mimeType string) {
+	start, end := int64(0), int64(len(content))-1
+
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		var err error
+
+		if start, end, err = parseRange(rangeHeader, int64(len(content))); err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "requestedRangeNotSatisfiable", err.Error())
+
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.Header().Set("Content-Type", mimeType)
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[start : end+1])
+
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Content-Type", mimeType)
+	_, _ = w.Write(content)
+}
+
+// exportFile handles the export of a Docs Editors file. The fake doesn't convert anything: the stored content is
+// returned whatever the requested format.
+func (s *Server) exportFile(w http.ResponseWriter, r *http.Request, id string) {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return
+	}
+
+	mimeType := r.Form.Get("mimeType")
+	if mimeType == "" {
+		writeError(w, http.StatusBadRequest, "required", "Required parameter: mimeType")
+		return
+	}
+
+	if !isDocsEditorsFile(n.file.MimeType) {
+		writeError(w, http.StatusForbidden, "fileNotExportable", "Export only supports Docs Editors files.")
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(n.content)))
+	w.Header().Set("Content-Type", mimeType)
+	_, _ = w.Write(n.content)
+}
+
+// isDocsEditorsFile returns true for the Google Docs, Sheets, Slides, etc. files, which can only be exported
+func isDocsEditorsFile(mimeType string) bool {
+	return strings.HasPrefix(mimeType, mimeTypeApps) && mimeType != mimeTypeFolder
+}
+
+// parseRange parses a single "bytes=start-end" range, end being inclusive
+func parseRange(header string, size int64) (int64, int64, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("unsupported range: %s", header)
+	}
+
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid range: %s", header)
+	}
+
+	var start, end int64
+
+	var err error
+
+	switch {
+	case bounds[0] == "":
+		// Suffix range: the last N bytes
+		var suffix int64
+		if suffix, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid range: %s", header)
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+
+		start, end = size-suffix, size-1
+	default:
+		if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid range: %s", header)
+		}
+
+		end = size - 1
+
+		if bounds[1] != "" {
+			if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+				return 0, 0, fmt.Errorf("invalid range: %s", header)
+			}
+
+			if end >= size {
+				end = size - 1
+			}
+		}
+	}
+
+	if start >= size || start > end {
+		return 0, 0, fmt.Errorf("range not satisfiable: %s", header)
+	}
+
+	return start, end, nil
+}
+
+// decodeMetadata decodes a JSON file metadata, it returns both the decoded structure and the raw fields so that we
+// know which fields were actually sent.
+func decodeMetadata(data []byte) (*drive.File, map[string]json.RawMessage, error) {
+	file := &drive.File{}
+	raw := make(map[string]json.RawMessage)
+
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		return file, raw, nil
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	return file, raw, nil
+}
+
+func (s *Server) readMetadata(w http.ResponseWriter, r *http.Request) (*drive.File, map[string]json.RawMessage, bool) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return nil, nil, false
+	}
+
+	meta, raw, err := decodeMetadata(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return nil, nil, false
+	}
+
+	return meta, raw, true
+}
+
+// createFile handles a file creation, content is nil when no media was sent
+func (s *Server) createFile(w http.ResponseWriter, r *http.Request, content []byte) {
+	meta, _, ok := s.readMetadata(w, r)
+	if !ok {
+		return
+	}
+
+	n, fail := s.create(meta, content)
+	if fail != nil {
+		fail.write(w)
+		return
+	}
+
+	writeJSON(w, r, n.value(), defaultFileFields)
+}
+
+// failure is an API error that is waiting to be written
+type failure struct {
+	code    int
+	reason  string
+	message string
+}
+
+func (f *failure) write(w http.ResponseWriter) {
+	writeError(w, f.code, f.reason, f.message)
+}
+
+func notFound(id string) *failure {
+	return &failure{code: http.StatusNotFound, reason: "notFound", message: fmt.Sprintf("File not found: %s.", id)}
+}
+
+func (s *Server) checkParent(id string) (string, *failure) {
+	parent := s.getNode(id)
+	if parent == nil {
+		return "", notFound(id)
+	}
+
+	if parent.file.MimeType != mimeTypeFolder {
+		return "", &failure{
+			code:    http.StatusBadRequest,
+			reason:  "invalidParent",
+			message: fmt.Sprintf("The parent %s is not a folder", id),
+		}
+	}
+
+	return parent.file.Id, nil
+}
+
+func (s *Server) create(meta *drive.File, content []byte) (*node, *failure) {
+	mimeType := meta.MimeType
+	if mimeType == "" {
+		mimeType = mimeTypeFile
+	}
+
+	file := s.newFile(meta.Name, mimeType)
+	file.Description = meta.Description
+	file.Properties = meta.Properties
+	file.AppProperties = meta.AppProperties
+
+	if meta.ModifiedTime != "" {
+		file.ModifiedTime = meta.ModifiedTime
+	}
+
+	parents := meta.Parents
+	if len(parents) == 0 {
+		parents = []string{s.rootID}
+	}
+
+	for _, p := range parents {
+		id, fail := s.checkParent(p)
+		if fail != nil {
+			return nil, fail
+		}
+
+		file.Parents = append(file.Parents, id)
+		file.DriveId = s.nodes[id].file.DriveId
+	}
+
+	n := &node{file: file}
+	s.nodes[file.Id] = n
+
+	if content != nil {
+		n.setContent(content, meta.ModifiedTime == "")
+	}
+
+	s.recordChange(file.Id)
+
+	return n, nil
+}
+
+// setContent replaces the content of a file, which creates a new revision
+func (n *node) setContent(content []byte, touch bool) {
+	n.content = content
+
+	if touch {
+		n.file.ModifiedTime = now()
+	}
+
+	// Like on Google Drive, the Docs Editors files don't have a size or checksums
+	if isDocsEditorsFile(n.file.MimeType) {
+		return
+	}
+
+	md5Sum := md5.Sum(content)   // nolint: gosec
+	sha1Sum := sha1.Sum(content) // nolint: gosec
+	sha256Sum := sha256.Sum256(content)
+
+	n.file.Size = int64(len(content))
+	n.file.Md5Checksum = hex.EncodeToString(md5Sum[:])
+	n.extra = map[string]interface{}{
+		"sha1Checksum":   hex.EncodeToString(sha1Sum[:]),
+		"sha256Checksum": hex.EncodeToString(sha256Sum[:]),
+	}
+
+	n.addRevision()
+}
+
+// updateFile handles a file update, content is nil when no media was sent
+func (s *Server) updateFile(w http.ResponseWriter, r *http.Request, id string, content []byte) {
+	_, raw, ok := s.readMetadata(w, r)
+	if !ok {
+		return
+	}
+
+	n, fail := s.update(id, raw, content, r.Form.Get("addParents"), r.Form.Get("removeParents"))
+	if fail != nil {
+		fail.write(w)
+		return
+	}
+
+	writeJSON(w, r, n.value(), defaultFileFields)
+}
+
+// readOnlyFields are the fields that can't be changed through an update
+var readOnlyFields = map[string]bool{
+	"id":                true,
+	"kind":              true,
+	"parents":           true,
+	"size":              true,
+	"md5Checksum":       true,
+	"createdTime":       true,
+	"explicitlyTrashed": true,
+	"trashedTime":       true,
+	"trashingUser":      true,
+	"headRevisionId":    true,
+}
+
+func (s *Server) update(
+	id string,
+	patch map[string]json.RawMessage,
+	content []byte,
+	addParents, removeParents string,
+) (*node, *failure) {
+	n := s.getNode(id)
+	if n == nil {
+		return nil, notFound(id)
+	}
+
+	if fail := s.moveNode(n, addParents, removeParents); fail != nil {
+		return nil, fail
+	}
+
+	if err := n.patch(patch); err != nil {
+		return nil, &failure{code: http.StatusBadRequest, reason: "invalid", message: err.Error()}
+	}
+
+	if trashed, ok := patch["trashed"]; ok {
+		s.setTrashed(n, string(trashed) == "true")
+	}
+
+	if content != nil {
+		_, mtime := patch["modifiedTime"]
+		n.setContent(content, !mtime)
+	}
+
+	s.recordChange(n.file.Id)
+
+	return n, nil
+}
+
+func (s *Server) moveNode(n *node, addParents, removeParents string) *failure {
+	var added []string
+
+	for _, p := range splitList(addParents) {
+		id, fail := s.checkParent(p)
+		if fail != nil {
+			return fail
+		}
+
+		added = append(added, id)
+		n.file.DriveId = s.nodes[id].file.DriveId
+	}
+
+	removed := make(map[string]bool)
+	for _, p := range splitList(removeParents) {
+		removed[s.resolveID(p)] = true
+	}
+
+	parents := make([]string, 0, len(n.file.Parents)+len(added))
+
+	for _, p := range n.file.Parents {
+		if !removed[p] {
+			parents = append(parents, p)
+		}
+	}
+
+	for _, p := range added {
+		if !contains(parents, p) {
+			parents = append(parents, p)
+		}
+	}
+
+	n.file.Parents = parents
+
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patch applies a JSON patch on the file metadata
+func (n *node) patch(patch map[string]json.RawMessage) error {
+	current, err := json.Marshal(n.file)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(current, &merged); err != nil {
+		return err
+	}
+
+	for key, value := range patch {
+		if readOnlyFields[key] {
+			continue
+		}
+
+		switch {
+		case string(value) == "null":
+			delete(merged, key)
+		case key == "properties" || key == "appProperties":
+			if merged[key], err = mergeProperties(merged[key], value); err != nil {
+				return err
+			}
+		default:
+			merged[key] = value
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	file := &drive.File{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return err
+	}
+
+	n.file = file
+
+	return nil
+}
+
+// mergeProperties merges properties like Google Drive does: a null value removes a property
+func mergeProperties(current, patch json.RawMessage) (json.RawMessage, error) {
+	properties := make(map[string]*string)
+
+	if len(current) > 0 {
+		if err := json.Unmarshal(current, &properties); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make(map[string]*string)
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(properties, key)
+		} else {
+			properties[key] = value
+		}
+	}
+
+	return json.Marshal(properties)
+}
+
+// setTrashed changes the trashed status of a file and of its descendants
+func (s *Server) setTrashed(n *node, trashed bool) {
+	n.file.Trashed = trashed
+	n.file.ExplicitlyTrashed = trashed
+	n.file.TrashedTime = ""
+	n.file.TrashingUser = nil
+
+	if trashed {
+		trashingUser := User
+		n.file.TrashedTime = now()
+		n.file.TrashingUser = &trashingUser
+	}
+
+	for _, d := range s.descendants(n.file.Id) {
+		if d.file.ExplicitlyTrashed {
+			continue
+		}
+
+		d.file.Trashed = trashed
+		d.file.TrashedTime = n.file.TrashedTime
+		d.file.TrashingUser = n.file.TrashingUser
+		s.recordChange(d.file.Id)
+	}
+}
+
+func (s *Server) deleteFile(w http.ResponseWriter, id string) {
+	n := s.getNode(id)
+	if n == nil || n.file.Id == s.rootID {
+		writeNotFound(w, id)
+		return
+	}
+
+	s.remove(n)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emptyTrash permanently deletes the trashed files of My Drive
+func (s *Server) emptyTrash(w http.ResponseWriter) {
+	var trashed []*node
+
+	for _, n := range s.nodes {
+		if n.file.ExplicitlyTrashed && n.file.DriveId == "" {
+			trashed = append(trashed, n)
+		}
+	}
+
+	for _, n := range trashed {
+		// It might have been removed with a trashed folder
+		if s.nodes[n.file.Id] != nil {
+			s.remove(n)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove permanently deletes a file and its descendants
+func (s *Server) remove(n *node) {
+	for _, d := range s.descendants(n.file.Id) {
+		delete(s.nodes, d.file.Id)
+		s.recordChange(d.file.Id)
+	}
+
+	delete(s.nodes, n.file.Id)
+	s.recordChange(n.file.Id)
+}
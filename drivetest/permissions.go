@@ -0,0 +1,303 @@
+package drivetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	defaultPermissionFields = "kind,id,type,role"
+	defaultPermissionsList  = "kind,nextPageToken,permissions(kind,id,type,role)"
+
+	defaultPermissionsPageSize = 100
+	maxPermissionsPageSize     = 100
+
+	// anyoneWithLinkID is the ID Google Drive gives to the permissions of type anyone that can't be found by searching
+	anyoneWithLinkID = "anyoneWithLink"
+	// anyoneID is the ID Google Drive gives to the permissions of type anyone that can be found by searching
+	anyoneID = "anyone"
+)
+
+// Notification is an email sent by the server when a file is shared
+type Notification struct {
+	FileID       string // FileID is the ID of the shared file
+	EmailAddress string // EmailAddress is the address of the user or group the file was shared with
+	Message      string // Message is the message added to the email, if any
+}
+
+// Notifications returns the emails sent when sharing files, in order
+func (s *Server) Notifications() []Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Notification(nil), s.notifications...)
+}
+
+func (s *Server) servePermissions(w http.ResponseWriter, r *http.Request, id string, parts []string) bool {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.listPermissions(w, r, id)
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		s.createPermission(w, r, id)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.getPermission(w, r, id, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		s.updatePermission(w, r, id, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.deletePermission(w, id, parts[0])
+	default:
+		return false
+	}
+
+	return true
+}
+
+// readPermission reads the permission sent in the body of a request
+func readPermission(w http.ResponseWriter, r *http.Request) (*drive.Permission, bool) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return nil, false
+	}
+
+	permission := &drive.Permission{}
+	if err := json.Unmarshal(data, permission); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", "Parse Error")
+		return nil, false
+	}
+
+	return permission, true
+}
+
+// checkPermission validates the fields of a permission like Google Drive does
+func checkPermission(p *drive.Permission) string {
+	switch p.Role {
+	case "owner", "organizer", "fileOrganizer", "writer", "commenter", "reader":
+	default:
+		return fmt.Sprintf("Invalid role: %q", p.Role)
+	}
+
+	switch p.Type {
+	case "user", "group":
+		if p.EmailAddress == "" {
+			return "An email address must be supplied"
+		}
+	case "domain":
+		if p.Domain == "" {
+			return "A domain must be supplied"
+		}
+	case "anyone":
+	default:
+		return fmt.Sprintf("Invalid permission type: %q", p.Type)
+	}
+
+	if p.ExpirationTime == "" {
+		return ""
+	}
+
+	if p.Type != "user" && p.Type != "group" {
+		return "Expiration dates can only be set on user and group permissions"
+	}
+
+	expiration, err := time.Parse(time.RFC3339, p.ExpirationTime)
+	if err != nil || !expiration.After(time.Now()) {
+		return "The expiration time must be in the future"
+	}
+
+	return ""
+}
+
+func (s *Server) createPermission(w http.ResponseWriter, r *http.Request, id string) {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return
+	}
+
+	permission, ok := readPermission(w, r)
+	if !ok {
+		return
+	}
+
+	if message := checkPermission(permission); message != "" {
+		writeError(w, http.StatusBadRequest, "invalid", message)
+		return
+	}
+
+	if permission.Role == "owner" && r.Form.Get("transferOwnership") != "true" {
+		writeError(w, http.StatusForbidden, "forbidden", "The transferOwnership parameter must be enabled")
+		return
+	}
+
+	permission.Kind = "drive#permission"
+	permission.DisplayName = permission.EmailAddress
+
+	if permission.Type == "domain" {
+		permission.DisplayName = permission.Domain
+	}
+
+	// Sharing again with the same grantee changes the existing permission
+	existing := n.findPermission(permission)
+
+	switch {
+	case existing != nil:
+		permission.Id = existing.Id
+		*existing = *permission
+	case permission.Type == "anyone" && permission.AllowFileDiscovery:
+		permission.Id = anyoneID
+		n.permissions = append(n.permissions, permission)
+	case permission.Type == "anyone":
+		permission.Id = anyoneWithLinkID
+		n.permissions = append(n.permissions, permission)
+	default:
+		permission.Id = s.nextID()
+		n.permissions = append(n.permissions, permission)
+	}
+
+	// The notifications are sent to the users and groups, unless disabled
+	if (permission.Type == "user" || permission.Type == "group") && r.Form.Get("sendNotificationEmail") != "false" {
+		s.notifications = append(s.notifications, Notification{
+			FileID:       n.file.Id,
+			EmailAddress: permission.EmailAddress,
+			Message:      r.Form.Get("emailMessage"),
+		})
+	}
+
+	writeJSON(w, r, permission, defaultPermissionFields)
+}
+
+// findPermission returns the permission of a file that has the same grantee as another one
+func (n *node) findPermission(permission *drive.Permission) *drive.Permission {
+	for _, p := range n.permissions {
+		if p.Type == permission.Type && p.EmailAddress == permission.EmailAddress && p.Domain == permission.Domain &&
+			p.AllowFileDiscovery == permission.AllowFileDiscovery {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// permission returns a permission of a file, writing an error if it doesn't exist
+func (s *Server) permission(w http.ResponseWriter, id, permissionID string) *drive.Permission {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return nil
+	}
+
+	for _, p := range n.permissions {
+		if p.Id == permissionID {
+			return p
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Permission not found: %s.", permissionID))
+
+	return nil
+}
+
+func (s *Server) getPermission(w http.ResponseWriter, r *http.Request, id, permissionID string) {
+	if p := s.permission(w, id, permissionID); p != nil {
+		writeJSON(w, r, p, defaultPermissionFields)
+	}
+}
+
+// updatePermission changes the role or the expiration time of a permission, the only fields that can be updated
+func (s *Server) updatePermission(w http.ResponseWriter, r *http.Request, id, permissionID string) {
+	p := s.permission(w, id, permissionID)
+	if p == nil {
+		return
+	}
+
+	patch, ok := readPermission(w, r)
+	if !ok {
+		return
+	}
+
+	updated := *p
+
+	if patch.Role != "" {
+		updated.Role = patch.Role
+	}
+
+	if patch.ExpirationTime != "" {
+		updated.ExpirationTime = patch.ExpirationTime
+	}
+
+	if r.Form.Get("removeExpiration") == "true" {
+		updated.ExpirationTime = ""
+	}
+
+	if message := checkPermission(&updated); message != "" {
+		writeError(w, http.StatusBadRequest, "invalid", message)
+		return
+	}
+
+	if updated.Role == "owner" && p.Role != "owner" && r.Form.Get("transferOwnership") != "true" {
+		writeError(w, http.StatusForbidden, "forbidden", "The transferOwnership parameter must be enabled")
+		return
+	}
+
+	*p = updated
+
+	writeJSON(w, r, p, defaultPermissionFields)
+}
+
+func (s *Server) deletePermission(w http.ResponseWriter, id, permissionID string) {
+	if s.permission(w, id, permissionID) == nil {
+		return
+	}
+
+	n := s.getNode(id)
+
+	for i, p := range n.permissions {
+		if p.Id == permissionID {
+			n.permissions = append(n.permissions[:i], n.permissions[i+1:]...)
+			break
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listPermissions(w http.ResponseWriter, r *http.Request, id string) {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return
+	}
+
+	pageSize := defaultPermissionsPageSize
+	if v := r.Form.Get("pageSize"); v != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 || pageSize > maxPermissionsPageSize {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page size: %s", v))
+			return
+		}
+	}
+
+	offset := 0
+	if v := r.Form.Get("pageToken"); v != "" {
+		var err error
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 || offset > len(n.permissions) {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page token: %s", v))
+			return
+		}
+	}
+
+	list := &drive.PermissionList{Kind: "drive#permissionList", Permissions: n.permissions[offset:]}
+
+	if end := offset + pageSize; end < len(n.permissions) {
+		list.Permissions = n.permissions[offset:end]
+		list.NextPageToken = strconv.Itoa(end)
+	}
+
+	writeJSON(w, r, list, defaultPermissionsList)
+}
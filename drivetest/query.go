@@ -0,0 +1,385 @@
+package drivetest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// predicate is a compiled search query
+type predicate func(f *drive.File) bool
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// tokenize splits a query like "'abc' in parents and name = 'it\'s'" into tokens
+func tokenize(q string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(q); {
+		c := q[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case c == '\'' || c == '"':
+			var value strings.Builder
+
+			j := i + 1
+			for ; j < len(q) && q[j] != c; j++ {
+				if q[j] == '\\' && j+1 < len(q) {
+					j++
+				}
+
+				value.WriteByte(q[j])
+			}
+
+			if j >= len(q) {
+				return nil, fmt.Errorf("unterminated string in query: %s", q)
+			}
+
+			tokens = append(tokens, token{kind: tokenString, value: value.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			j := i + 1
+			if j < len(q) && q[j] == '=' {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, value: q[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(q) && !strings.ContainsRune(" \t\n()'\"=!<>", rune(q[j])) {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, value: q[i:j]})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+// queryParser is a recursive descent parser for the Drive search query language:
+//
+//	expr := and { "or" and }
+//	and  := term { "and" term }
+//	term := "not" term | "(" expr ")" | value operator value
+type queryParser struct {
+	tokens []token
+	pos    int
+	rootID string
+}
+
+// parseQuery compiles a search query, an empty query matches everything
+func parseQuery(q string, rootID string) (predicate, error) {
+	tokens, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return func(*drive.File) bool { return true }, nil
+	}
+
+	p := &queryParser{tokens: tokens, rootID: rootID}
+
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in query: %s", p.tokens[p.pos].value, q)
+	}
+
+	return pred, nil
+}
+
+func (p *queryParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+
+	return &p.tokens[p.pos]
+}
+
+func (p *queryParser) next() (*token, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	p.pos++
+
+	return t, nil
+}
+
+func (p *queryParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+func (p *queryParser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("or") {
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(f *drive.File) bool { return l(f) || right(f) }
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (predicate, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("and") {
+		p.pos++
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(f *drive.File) bool { return l(f) && right(f) }
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseTerm() (predicate, error) {
+	if p.isKeyword("not") {
+		p.pos++
+
+		sub, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(f *drive.File) bool { return !sub(f) }, nil
+	}
+
+	if t := p.peek(); t != nil && t.kind == tokenOpen {
+		p.pos++
+
+		sub, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t, err := p.next(); err != nil || t.kind != tokenClose {
+			return nil, fmt.Errorf("missing closing parenthesis in query")
+		}
+
+		return sub, nil
+	}
+
+	return p.parseCondition()
+}
+
+func (p *queryParser) parseCondition() (predicate, error) {
+	left, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	op := strings.ToLower(operator.value)
+
+	// "'value' in collection" conditions
+	if left.kind == tokenString && op == "in" {
+		return p.inCondition(left.value, right.value)
+	}
+
+	if left.kind != tokenWord {
+		return nil, fmt.Errorf("unsupported condition on %q", left.value)
+	}
+
+	return fieldCondition(left.value, op, right)
+}
+
+func (p *queryParser) inCondition(value, collection string) (predicate, error) {
+	switch collection {
+	case "parents":
+		if value == "root" {
+			value = p.rootID
+		}
+
+		return func(f *drive.File) bool {
+			for _, parent := range f.Parents {
+				if parent == value {
+					return true
+				}
+			}
+
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported collection %q", collection)
+	}
+}
+
+func fieldCondition(field, op string, value *token) (predicate, error) {
+	switch field {
+	case "name", "mimeType":
+		return stringCondition(field, op, value.value)
+	case "trashed", "starred":
+		if value.kind != tokenWord {
+			return nil, fmt.Errorf("%s expects a boolean", field)
+		}
+
+		expected := strings.EqualFold(value.value, "true")
+
+		switch op {
+		case "=":
+			return func(f *drive.File) bool { return boolField(f, field) == expected }, nil
+		case "!=":
+			return func(f *drive.File) bool { return boolField(f, field) != expected }, nil
+		}
+	case "modifiedTime", "createdTime", "viewedByMeTime":
+		return timeCondition(field, op, value.value)
+	}
+
+	return nil, fmt.Errorf("unsupported condition: %s %s", field, op)
+}
+
+func stringField(f *drive.File, field string) string {
+	switch field {
+	case "name":
+		return f.Name
+	case "mimeType":
+		return f.MimeType
+	case "modifiedTime":
+		return f.ModifiedTime
+	case "createdTime":
+		return f.CreatedTime
+	case "viewedByMeTime":
+		return f.ViewedByMeTime
+	}
+
+	return ""
+}
+
+func boolField(f *drive.File, field string) bool {
+	switch field {
+	case "trashed":
+		return f.Trashed
+	case "starred":
+		return f.Starred
+	}
+
+	return false
+}
+
+// stringCondition compares string fields. Like on Google Drive, name comparisons are case insensitive.
+func stringCondition(field, op, value string) (predicate, error) {
+	equal := func(a, b string) bool { return a == b }
+	if field == "name" {
+		equal = strings.EqualFold
+	}
+
+	switch op {
+	case "=":
+		return func(f *drive.File) bool { return equal(stringField(f, field), value) }, nil
+	case "!=":
+		return func(f *drive.File) bool { return !equal(stringField(f, field), value) }, nil
+	case "contains":
+		return func(f *drive.File) bool {
+			return strings.Contains(strings.ToLower(stringField(f, field)), strings.ToLower(value))
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator %q for %s", op, field)
+}
+
+func timeCondition(field, op, value string) (predicate, error) {
+	reference, err := parseTime(value)
+	if err != nil {
+		return nil, err
+	}
+
+	compare := func(f *drive.File) int {
+		t, _ := parseTime(stringField(f, field))
+
+		switch {
+		case t.Before(reference):
+			return -1
+		case t.After(reference):
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	switch op {
+	case "=":
+		return func(f *drive.File) bool { return compare(f) == 0 }, nil
+	case "!=":
+		return func(f *drive.File) bool { return compare(f) != 0 }, nil
+	case "<":
+		return func(f *drive.File) bool { return compare(f) < 0 }, nil
+	case "<=":
+		return func(f *drive.File) bool { return compare(f) <= 0 }, nil
+	case ">":
+		return func(f *drive.File) bool { return compare(f) > 0 }, nil
+	case ">=":
+		return func(f *drive.File) bool { return compare(f) >= 0 }, nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator %q for %s", op, field)
+}
+
+// parseTime parses RFC 3339 times, the time zone being optional (UTC is then assumed)
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02T15:04:05", s)
+}
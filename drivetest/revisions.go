@@ -0,0 +1,180 @@
+package drivetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	defaultRevisionFields = "kind,id,mimeType,modifiedTime"
+	defaultRevisionsList  = "kind,nextPageToken,revisions(kind,id,mimeType,modifiedTime)"
+
+	defaultRevisionsPageSize = 200
+	maxRevisionsPageSize     = 1000
+)
+
+// revision is a version of the content of a file
+type revision struct {
+	meta    *drive.Revision // meta is the metadata of the revision
+	content []byte          // content is the content of the file at this revision
+}
+
+// addRevision records the current content of a file as its head revision
+func (n *node) addRevision() {
+	n.revisionID++
+	user := User
+
+	r := &revision{
+		meta: &drive.Revision{
+			Kind:              "drive#revision",
+			Id:                strconv.FormatInt(n.revisionID, 10),
+			MimeType:          n.file.MimeType,
+			ModifiedTime:      n.file.ModifiedTime,
+			OriginalFilename:  n.file.Name,
+			Size:              n.file.Size,
+			Md5Checksum:       n.file.Md5Checksum,
+			LastModifyingUser: &user,
+		},
+		content: n.content,
+	}
+
+	n.revisions = append(n.revisions, r)
+	n.file.HeadRevisionId = r.meta.Id
+}
+
+func (s *Server) serveRevisions(w http.ResponseWriter, r *http.Request, id string, parts []string) bool {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.listRevisions(w, r, id)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.getRevision(w, r, id, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		s.updateRevision(w, r, id, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.deleteRevision(w, id, parts[0])
+	default:
+		return false
+	}
+
+	return true
+}
+
+// revision returns a revision of a file, writing an error if it doesn't exist
+func (s *Server) revision(w http.ResponseWriter, id, revisionID string) (*node, int) {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return nil, -1
+	}
+
+	for i, r := range n.revisions {
+		if r.meta.Id == revisionID {
+			return n, i
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Revision not found: %s.", revisionID))
+
+	return nil, -1
+}
+
+func (s *Server) getRevision(w http.ResponseWriter, r *http.Request, id, revisionID string) {
+	n, i := s.revision(w, id, revisionID)
+	if n == nil {
+		return
+	}
+
+	if r.Form.Get("alt") == "media" {
+		writeContent(w, r, n.revisions[i].content, n.revisions[i].meta.MimeType)
+		return
+	}
+
+	writeJSON(w, r, n.revisions[i].meta, defaultRevisionFields)
+}
+
+// updateRevision changes whether a revision is kept forever, the only field of the fake that can be updated
+func (s *Server) updateRevision(w http.ResponseWriter, r *http.Request, id, revisionID string) {
+	n, i := s.revision(w, id, revisionID)
+	if n == nil {
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+
+	patch := &drive.Revision{}
+	if err := json.Unmarshal(data, patch); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", "Parse Error")
+		return
+	}
+
+	meta := n.revisions[i].meta
+	meta.KeepForever = patch.KeepForever
+
+	writeJSON(w, r, meta, defaultRevisionFields)
+}
+
+// deleteRevision deletes a revision, except the head one
+func (s *Server) deleteRevision(w http.ResponseWriter, id, revisionID string) {
+	n, i := s.revision(w, id, revisionID)
+	if n == nil {
+		return
+	}
+
+	if i == len(n.revisions)-1 {
+		writeError(w, http.StatusBadRequest, "cannotDeleteHeadRevision", "The head revision can't be deleted.")
+		return
+	}
+
+	n.revisions = append(n.revisions[:i], n.revisions[i+1:]...)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request, id string) {
+	n := s.getNode(id)
+	if n == nil {
+		writeNotFound(w, id)
+		return
+	}
+
+	pageSize := defaultRevisionsPageSize
+	if v := r.Form.Get("pageSize"); v != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 || pageSize > maxRevisionsPageSize {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page size: %s", v))
+			return
+		}
+	}
+
+	offset := 0
+	if v := r.Form.Get("pageToken"); v != "" {
+		var err error
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 || offset > len(n.revisions) {
+			writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid page token: %s", v))
+			return
+		}
+	}
+
+	revisions := make([]*drive.Revision, 0, len(n.revisions))
+	for _, r := range n.revisions {
+		revisions = append(revisions, r.meta)
+	}
+
+	list := &drive.RevisionList{Kind: "drive#revisionList", Revisions: revisions[offset:]}
+
+	if end := offset + pageSize; end < len(revisions) {
+		list.Revisions = revisions[offset:end]
+		list.NextPageToken = strconv.Itoa(end)
+	}
+
+	writeJSON(w, r, list, defaultRevisionsList)
+}
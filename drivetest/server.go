@@ -0,0 +1,401 @@
+// Package drivetest provides an in-process fake of the Google Drive v3 API
+//
+// The fake only implements the subset of the API used by the driver. It is meant to be used for tests that can't
+// (or shouldn't) talk to the real Google Drive. The usual way to use it is:
+//
+//	server := drivetest.NewServer()
+//	defer server.Close()
+//	driver, err := gdrive.New(server.Client())
+package drivetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	apiPrefix    = "/drive/v3/"
+	uploadPrefix = "/upload/drive/v3/"
+
+	mimeTypeFolder = "application/vnd.google-apps.folder"
+	mimeTypeFile   = "application/octet-stream"
+	mimeTypeApps   = "application/vnd.google-apps."
+
+	timeFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// node is a file or a folder stored in the fake drive
+type node struct {
+	file        *drive.File            // file is the metadata of the file
+	extra       map[string]interface{} // extra contains the metadata fields that drive.File doesn't declare
+	content     []byte                 // content is the media of the file
+	permissions []*drive.Permission    // permissions are the permissions created through the API
+	revisions   []*revision            // revisions are the versions of the content, the last one being the head
+	revisionID  int64                  // revisionID is used to generate the IDs of the revisions
+}
+
+// value returns the JSON representation of the file
+func (n *node) value() map[string]interface{} {
+	value := make(map[string]interface{})
+
+	if raw, err := json.Marshal(n.file); err == nil {
+		_ = json.Unmarshal(raw, &value)
+	}
+
+	value["kind"] = "drive#file"
+
+	// The user owns all the files
+	value["capabilities"] = map[string]interface{}{"canEdit": true}
+
+	if len(n.permissions) > 0 {
+		ids := make([]interface{}, 0, len(n.permissions))
+		for _, p := range n.permissions {
+			ids = append(ids, p.Id)
+		}
+
+		value["permissionIds"] = ids
+	}
+
+	for k, v := range n.extra {
+		value[k] = v
+	}
+
+	return value
+}
+
+// User is the user of the fake drive, who trashes the files for instance
+var User = drive.User{
+	Kind:         "drive#user",
+	DisplayName:  "Test User",
+	EmailAddress: "test@example.com",
+	Me:           true,
+}
+
+// Server is an in-memory fake of the Google Drive v3 API
+type Server struct {
+	srv      *httptest.Server        // srv is the underlying HTTP server
+	mu       sync.Mutex              // mu protects everything below
+	nodes    map[string]*node        // nodes contains all the files and folders, by ID
+	uploads  map[string]*upload      // uploads contains the resumable upload sessions, by upload ID
+	drives   map[string]*drive.Drive // drives contains the shared drives, by ID
+	changes  []change                // changes is the log of the changes, to serve the Changes API
+	rootID   string                  // rootID is the ID of the "My Drive" folder
+	lastID   int64                   // lastID is used to generate new IDs
+	failures []Failure               // failures are the errors to return instead of handling the next requests
+
+	notifications []Notification // notifications are the emails sent when sharing files
+}
+
+// Failure is an error returned by the server instead of handling a request
+type Failure struct {
+	Code       int           // Code is the HTTP status code of the error
+	Reason     string        // Reason is the reason of the error, like "userRateLimitExceeded" or "backendError"
+	Method     string        // Method restricts the failure to the requests using this HTTP method, if set
+	RetryAfter time.Duration // RetryAfter sets the Retry-After header, if set
+}
+
+// NewServer creates and starts a new fake Google Drive server
+func NewServer() *Server {
+	s := &Server{
+		nodes:   make(map[string]*node),
+		uploads: make(map[string]*upload),
+		drives:  make(map[string]*drive.Drive),
+	}
+
+	root := s.newFile("My Drive", mimeTypeFolder)
+	s.rootID = root.Id
+	s.nodes[root.Id] = &node{file: root}
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base URL of the server
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// RootID returns the ID of the root folder ("My Drive")
+func (s *Server) RootID() string {
+	return s.rootID
+}
+
+// Fail makes the server return errors for the next requests. Each failure is used once, in order, by the first
+// request that matches it.
+func (s *Server) Fail(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failures...)
+}
+
+// PendingFailures returns the number of failures that weren't used yet
+func (s *Server) PendingFailures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.failures)
+}
+
+// takeFailure removes and returns the first failure matching a request
+func (s *Server) takeFailure(r *http.Request) *Failure {
+	for i, failure := range s.failures {
+		if failure.Method == "" || failure.Method == r.Method {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			return &failure
+		}
+	}
+
+	return nil
+}
+
+// Client returns an HTTP client that sends all its requests to this server, whatever host they target.
+// This allows to use the standard drive.Service (and thus gdrive.New) without any change of endpoint.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.srv.URL)
+
+	return &http.Client{
+		Transport: &rewriteTransport{
+			target: target,
+			base:   s.srv.Client().Transport,
+		},
+	}
+}
+
+// rewriteTransport redirects every request to the fake server
+type rewriteTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rewritten := req.Clone(req.Context())
+	rewritten.URL.Scheme = t.target.Scheme
+	rewritten.URL.Host = t.target.Host
+	rewritten.Host = ""
+
+	return t.base.RoundTrip(rewritten)
+}
+
+func (s *Server) nextID() string {
+	s.lastID++
+	return fmt.Sprintf("fake%012d", s.lastID)
+}
+
+func now() string {
+	return time.Now().UTC().Format(timeFormat)
+}
+
+func (s *Server) newFile(name, mimeType string) *drive.File {
+	t := now()
+
+	return &drive.File{
+		Id:           s.nextID(),
+		Name:         name,
+		MimeType:     mimeType,
+		CreatedTime:  t,
+		ModifiedTime: t,
+	}
+}
+
+// resolveID handles the "root" alias
+func (s *Server) resolveID(id string) string {
+	if id == "root" {
+		return s.rootID
+	}
+
+	return id
+}
+
+func (s *Server) getNode(id string) *node {
+	return s.nodes[s.resolveID(id)]
+}
+
+// children returns the direct children of a folder
+func (s *Server) children(id string) []*node {
+	var list []*node
+
+	for _, n := range s.nodes {
+		for _, p := range n.file.Parents {
+			if p == id {
+				list = append(list, n)
+				break
+			}
+		}
+	}
+
+	return list
+}
+
+// descendants returns all the descendants of a folder
+func (s *Server) descendants(id string) []*node {
+	var list []*node
+
+	for _, child := range s.children(id) {
+		list = append(list, child)
+		list = append(list, s.descendants(child.file.Id)...)
+	}
+
+	return list
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failure := s.takeFailure(r); failure != nil {
+		if failure.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(failure.RetryAfter.Seconds())))
+		}
+
+		writeError(w, failure.Code, failure.Reason, fmt.Sprintf("Injected failure: %s", failure.Reason))
+
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, uploadPrefix):
+		s.serveUpload(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, uploadPrefix), "/"))
+	case strings.HasPrefix(r.URL.Path, apiPrefix):
+		s.serveAPI(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"))
+	default:
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Unknown path: %s", r.URL.Path))
+	}
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, parts []string) {
+	if parts[0] == "drives" && s.serveDrives(w, r, parts) {
+		return
+	}
+
+	if parts[0] == "changes" && s.serveChanges(w, r, parts) {
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "files":
+		switch r.Method {
+		case http.MethodGet:
+			s.listFiles(w, r)
+			return
+		case http.MethodPost:
+			s.createFile(w, r, nil)
+			return
+		}
+	case len(parts) == 2 && parts[0] == "files" && parts[1] == "trash":
+		if r.Method == http.MethodDelete {
+			s.emptyTrash(w)
+			return
+		}
+	case len(parts) == 2 && parts[0] == "files":
+		switch r.Method {
+		case http.MethodGet:
+			s.getFile(w, r, parts[1])
+			return
+		case http.MethodPatch:
+			s.updateFile(w, r, parts[1], nil)
+			return
+		case http.MethodDelete:
+			s.deleteFile(w, parts[1])
+			return
+		}
+	case len(parts) >= 3 && parts[0] == "files" && parts[2] == "permissions":
+		if s.servePermissions(w, r, parts[1], parts[3:]) {
+			return
+		}
+	case len(parts) >= 3 && parts[0] == "files" && parts[2] == "revisions":
+		if s.serveRevisions(w, r, parts[1], parts[3:]) {
+			return
+		}
+	case len(parts) == 3 && parts[0] == "files" && parts[2] == "export":
+		if r.Method == http.MethodGet {
+			s.exportFile(w, r, parts[1])
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Unsupported call: %s %s", r.Method, r.URL.Path))
+}
+
+// apiError mimics the JSON errors returned by the Google APIs
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Errors  []apiErrorItem `json:"errors"`
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+}
+
+type apiErrorItem struct {
+	Domain  string `json:"domain"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(&apiError{
+		Error: apiErrorBody{
+			Errors:  []apiErrorItem{{Domain: "global", Reason: reason, Message: message}},
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+func writeNotFound(w http.ResponseWriter, id string) {
+	writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("File not found: %s.", id))
+}
+
+// writeJSON writes an API object, only keeping the fields that were requested
+func writeJSON(w http.ResponseWriter, r *http.Request, value interface{}, defaultFields string) {
+	fields := r.Form.Get("fields")
+	if fields == "" {
+		fields = defaultFields
+	}
+
+	mask, err := parseFields(fields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidParameter", err.Error())
+		return
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internalError", err.Error())
+		return
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		writeError(w, http.StatusInternalServerError, "internalError", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	_ = json.NewEncoder(w).Encode(mask.apply(generic))
+}
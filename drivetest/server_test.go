@@ -0,0 +1,294 @@
+package drivetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+func newService(t *testing.T) (*Server, *drive.Service) {
+	server := NewServer()
+	t.Cleanup(server.Close)
+
+	srv, err := drive.NewService(context.Background(), option.WithHTTPClient(server.Client()))
+	require.NoError(t, err)
+
+	return server, srv
+}
+
+func TestQuery(t *testing.T) {
+	file := &drive.File{
+		Name:         "It's a file",
+		MimeType:     "text/plain",
+		Parents:      []string{"parent1"},
+		ModifiedTime: "2021-03-01T10:00:00.000Z",
+	}
+
+	for q, expected := range map[string]bool{
+		"":                                      true,
+		"'parent1' in parents":                  true,
+		"'parent2' in parents":                  false,
+		"name = 'it\\'s a FILE'":                true,
+		"name='other'":                          false,
+		"name contains 'file'":                  true,
+		"trashed = false":                       true,
+		"trashed=true":                          false,
+		"not trashed = true":                    true,
+		"mimeType != 'text/plain'":              false,
+		"modifiedTime < '2021-02-28T00:00:00Z'": false,
+		"modifiedTime < '2021-03-02T00:00:00'":  true,
+		"'parent2' in parents or name = 'It\\'s a file'":                       true,
+		"'parent1' in parents and (trashed = true or mimeType = 'text/plain')": true,
+	} {
+		match, err := parseQuery(q, "root")
+		require.NoError(t, err, q)
+		require.Equal(t, expected, match(file), q)
+	}
+
+	for _, q := range []string{"name =", "'a' in owners", "(trashed = true", "name = 'a"} {
+		_, err := parseQuery(q, "root")
+		require.Error(t, err, q)
+	}
+}
+
+func TestFields(t *testing.T) {
+	mask, err := parseFields("nextPageToken,files(id,name),kind/x")
+	require.NoError(t, err)
+
+	filtered := mask.apply(map[string]interface{}{
+		"nextPageToken": "2",
+		"kind":          map[string]interface{}{"x": 1, "y": 2},
+		"other":         true,
+		"files": []interface{}{
+			map[string]interface{}{"id": "1", "name": "a", "size": "3"},
+		},
+	})
+
+	require.Equal(t, map[string]interface{}{
+		"nextPageToken": "2",
+		"kind":          map[string]interface{}{"x": 1},
+		"files": []interface{}{
+			map[string]interface{}{"id": "1", "name": "a"},
+		},
+	}, filtered)
+
+	_, err = parseFields("files(id")
+	require.Error(t, err)
+}
+
+func TestFiles(t *testing.T) {
+	server, srv := newService(t)
+	req := require.New(t)
+
+	folder, err := srv.Files.Create(&drive.File{
+		Name:     "folder",
+		MimeType: mimeTypeFolder,
+		Parents:  []string{"root"},
+	}).Fields("id,parents").Do()
+	req.NoError(err)
+	req.Equal([]string{server.RootID()}, folder.Parents)
+
+	file, err := srv.Files.Create(&drive.File{Name: "file", Parents: []string{folder.Id}}).
+		Media(bytes.NewReader([]byte("Hello World"))).
+		Fields("id,size,md5Checksum").Do()
+	req.NoError(err)
+	req.EqualValues(11, file.Size)
+	req.Equal("b10a8db164e0754105b7a99be72e3fe5", file.Md5Checksum)
+
+	t.Run("list", func(t *testing.T) {
+		list, err := srv.Files.List().Q("'" + folder.Id + "' in parents and trashed = false").Fields("files(id)").Do()
+		require.NoError(t, err)
+		require.Len(t, list.Files, 1)
+		require.Equal(t, file.Id, list.Files[0].Id)
+		require.Empty(t, list.Files[0].Name)
+	})
+
+	t.Run("download range", func(t *testing.T) {
+		call := srv.Files.Get(file.Id)
+		call.Header().Set("Range", "bytes=6-")
+		resp, err := call.Download()
+		require.NoError(t, err)
+		defer func() { require.NoError(t, resp.Body.Close()) }()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "World", string(data))
+	})
+
+	t.Run("resumable upload", func(t *testing.T) {
+		content := bytes.Repeat([]byte("0123456789"), 100)
+		updated, err := srv.Files.Update(file.Id, nil).
+			Media(bytes.NewReader(content), googleapi.ChunkSize(256)).
+			Fields("size").Do()
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), updated.Size)
+	})
+
+	t.Run("revisions", func(t *testing.T) {
+		list, err := srv.Revisions.List(file.Id).Fields("revisions(id,size,keepForever)").Do()
+		require.NoError(t, err)
+		require.Len(t, list.Revisions, 2)
+		require.EqualValues(t, 11, list.Revisions[0].Size)
+
+		first := list.Revisions[0].Id
+		call := srv.Revisions.Get(file.Id, first)
+		call.Header().Set("Range", "bytes=0-4")
+		resp, err := call.Download()
+		require.NoError(t, err)
+		defer func() { require.NoError(t, resp.Body.Close()) }()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "Hello", string(data))
+
+		pinned, err := srv.Revisions.Update(file.Id, first, &drive.Revision{KeepForever: true}).
+			Fields("keepForever").Do()
+		require.NoError(t, err)
+		require.True(t, pinned.KeepForever)
+
+		require.Error(t, srv.Revisions.Delete(file.Id, list.Revisions[1].Id).Do())
+		require.NoError(t, srv.Revisions.Delete(file.Id, first).Do())
+
+		_, err = srv.Revisions.Get(file.Id, first).Do()
+		require.True(t, isNotFound(err))
+	})
+
+	t.Run("move", func(t *testing.T) {
+		moved, err := srv.Files.Update(file.Id, &drive.File{Name: "renamed"}).
+			AddParents("root").RemoveParents(folder.Id).Fields("name,parents").Do()
+		require.NoError(t, err)
+		require.Equal(t, "renamed", moved.Name)
+		require.Equal(t, []string{server.RootID()}, moved.Parents)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		created, err := srv.Permissions.Create(file.Id, &drive.Permission{
+			Type:         "user",
+			Role:         "reader",
+			EmailAddress: "reader@example.com",
+		}).SendNotificationEmail(false).Fields("id,role").Do()
+		require.NoError(t, err)
+		require.Equal(t, "reader", created.Role)
+		require.Empty(t, server.Notifications())
+
+		_, err = srv.Permissions.Update(file.Id, created.Id, &drive.Permission{Role: "owner"}).Do()
+		require.Error(t, err)
+
+		updated, err := srv.Permissions.Update(file.Id, created.Id, &drive.Permission{Role: "writer"}).
+			Fields("role").Do()
+		require.NoError(t, err)
+		require.Equal(t, "writer", updated.Role)
+
+		list, err := srv.Permissions.List(file.Id).Fields("permissions(id,emailAddress)").Do()
+		require.NoError(t, err)
+		require.Len(t, list.Permissions, 1)
+		require.Equal(t, "reader@example.com", list.Permissions[0].EmailAddress)
+
+		require.NoError(t, srv.Permissions.Delete(file.Id, created.Id).Do())
+
+		_, err = srv.Permissions.Get(file.Id, created.Id).Do()
+		require.True(t, isNotFound(err))
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		_, err := srv.Files.Update(folder.Id, &drive.File{Trashed: true}).Do()
+		require.NoError(t, err)
+
+		list, err := srv.Files.List().Q("trashed = true").Fields("files(id)").Do()
+		require.NoError(t, err)
+		require.Len(t, list.Files, 1)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, srv.Files.Delete(folder.Id).Do())
+
+		_, err := srv.Files.Get(folder.Id).Do()
+		require.True(t, isNotFound(err))
+	})
+
+	t.Run("empty trash", func(t *testing.T) {
+		file, err := srv.Files.Create(&drive.File{Name: "trashed"}).Do()
+		require.NoError(t, err)
+
+		_, err = srv.Files.Update(file.Id, &drive.File{Trashed: true}).Do()
+		require.NoError(t, err)
+		require.NoError(t, srv.Files.EmptyTrash().Do())
+
+		_, err = srv.Files.Get(file.Id).Do()
+		require.True(t, isNotFound(err))
+	})
+}
+
+func TestExport(t *testing.T) {
+	_, srv := newService(t)
+
+	doc, err := srv.Files.Create(&drive.File{Name: "doc", MimeType: "application/vnd.google-apps.document"}).
+		Media(bytes.NewReader([]byte("Hello World"))).
+		Fields("id,size").Do()
+	require.NoError(t, err)
+	require.Zero(t, doc.Size)
+
+	resp, err := srv.Files.Export(doc.Id, "text/plain").Download()
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, resp.Body.Close()) }()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "Hello World", string(data))
+	require.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+
+	_, err = srv.Files.Get(doc.Id).Download() // nolint: bodyclose
+	require.Error(t, err)
+
+	file, err := srv.Files.Create(&drive.File{Name: "file"}).Media(bytes.NewReader([]byte("data"))).Do()
+	require.NoError(t, err)
+
+	_, err = srv.Files.Export(file.Id, "text/plain").Download() // nolint: bodyclose
+	require.Error(t, err)
+}
+
+func TestChanges(t *testing.T) {
+	_, srv := newService(t)
+
+	start, err := srv.Changes.GetStartPageToken().Do()
+	require.NoError(t, err)
+
+	file, err := srv.Files.Create(&drive.File{Name: "file"}).Do()
+	require.NoError(t, err)
+
+	_, err = srv.Files.Update(file.Id, &drive.File{Name: "renamed"}).Do()
+	require.NoError(t, err)
+
+	other, err := srv.Files.Create(&drive.File{Name: "other"}).Do()
+	require.NoError(t, err)
+	require.NoError(t, srv.Files.Delete(other.Id).Do())
+
+	changes, err := srv.Changes.List(start.StartPageToken).PageSize(3).Fields("*").Do()
+	require.NoError(t, err)
+	require.Len(t, changes.Changes, 3)
+	require.Equal(t, "renamed", changes.Changes[0].File.Name)
+	require.Empty(t, changes.NewStartPageToken)
+
+	changes, err = srv.Changes.List(changes.NextPageToken).Fields("*").Do()
+	require.NoError(t, err)
+	require.Len(t, changes.Changes, 1)
+	require.True(t, changes.Changes[0].Removed)
+	require.Equal(t, other.Id, changes.Changes[0].FileId)
+	require.NotEmpty(t, changes.NewStartPageToken)
+
+	changes, err = srv.Changes.List(changes.NewStartPageToken).Do()
+	require.NoError(t, err)
+	require.Empty(t, changes.Changes)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,251 @@
+package drivetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// upload is a resumable upload session
+type upload struct {
+	fileID        string       // fileID is the ID of the updated file, empty for a creation
+	metadata      []byte       // metadata is the JSON metadata sent when the session was opened
+	addParents    string       // addParents is the addParents parameter of an update
+	removeParents string       // removeParents is the removeParents parameter of an update
+	fields        string       // fields is the fields parameter of the initial call
+	content       bytes.Buffer // content is the data received so far
+	done          bool         // done is set once the upload was completed
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 1 || parts[0] != "files" || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Unsupported upload path: %s", r.URL.Path))
+		return
+	}
+
+	if uploadID := r.Form.Get("upload_id"); uploadID != "" {
+		s.resumeUpload(w, r, uploadID)
+		return
+	}
+
+	fileID := ""
+	if len(parts) == 2 {
+		fileID = parts[1]
+	}
+
+	if (fileID == "" && r.Method != http.MethodPost) || (fileID != "" && r.Method != http.MethodPatch) {
+		writeError(w, http.StatusMethodNotAllowed, "badRequest", fmt.Sprintf("Unsupported method %s", r.Method))
+		return
+	}
+
+	switch r.Form.Get("uploadType") {
+	case "multipart":
+		s.uploadMultipart(w, r, fileID)
+	case "media":
+		s.uploadMedia(w, r, fileID)
+	case "resumable":
+		s.startResumableUpload(w, r, fileID)
+	default:
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid upload type: %s", r.Form.Get("uploadType")))
+	}
+}
+
+// finishUpload creates or updates the file once we have both its metadata and its content
+func (s *Server) finishUpload(
+	w http.ResponseWriter, r *http.Request,
+	fileID string, metadata []byte, content []byte, contentType string,
+) {
+	meta, raw, err := decodeMetadata(metadata)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return
+	}
+
+	var n *node
+
+	var fail *failure
+
+	if fileID == "" {
+		if meta.MimeType == "" && contentType != "" {
+			meta.MimeType = contentType
+		}
+
+		n, fail = s.create(meta, content)
+	} else {
+		n, fail = s.update(fileID, raw, content, r.Form.Get("addParents"), r.Form.Get("removeParents"))
+	}
+
+	if fail != nil {
+		fail.write(w)
+		return
+	}
+
+	writeJSON(w, r, n.value(), defaultFileFields)
+}
+
+func (s *Server) uploadMultipart(w http.ResponseWriter, r *http.Request, fileID string) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		writeError(w, http.StatusBadRequest, "badContent", "A multipart body is expected")
+		return
+	}
+
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	var contents [2][]byte
+
+	var contentType string
+
+	for i := range contents {
+		part, err := reader.NextPart()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "badContent", fmt.Sprintf("Missing part %d: %v", i, err))
+			return
+		}
+
+		if contents[i], err = ioutil.ReadAll(part); err != nil {
+			writeError(w, http.StatusBadRequest, "badContent", err.Error())
+			return
+		}
+
+		contentType = part.Header.Get("Content-Type")
+	}
+
+	s.finishUpload(w, r, fileID, contents[0], contents[1], contentType)
+}
+
+func (s *Server) uploadMedia(w http.ResponseWriter, r *http.Request, fileID string) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badContent", err.Error())
+		return
+	}
+
+	s.finishUpload(w, r, fileID, nil, content, r.Header.Get("Content-Type"))
+}
+
+func (s *Server) startResumableUpload(w http.ResponseWriter, r *http.Request, fileID string) {
+	if fileID != "" && s.getNode(fileID) == nil {
+		writeNotFound(w, fileID)
+		return
+	}
+
+	metadata, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badContent", err.Error())
+		return
+	}
+
+	uploadID := s.nextID()
+	s.uploads[uploadID] = &upload{
+		fileID:        fileID,
+		metadata:      metadata,
+		addParents:    r.Form.Get("addParents"),
+		removeParents: r.Form.Get("removeParents"),
+		fields:        r.Form.Get("fields"),
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("http://%s%s?uploadType=resumable&upload_id=%s", r.Host, r.URL.Path, uploadID))
+	w.WriteHeader(http.StatusOK)
+}
+
+// resumeUpload receives a chunk of a resumable upload, or a status request (an empty body with a "bytes */*" range)
+func (s *Server) resumeUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	up, ok := s.uploads[uploadID]
+	if !ok || up.done {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("Upload session not found: %s", uploadID))
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badContent", err.Error())
+		return
+	}
+
+	start, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badContent", err.Error())
+		return
+	}
+
+	received := int64(up.content.Len())
+
+	if start >= 0 && len(data) > 0 {
+		if start > received {
+			writeError(w, http.StatusBadRequest, "badContent", fmt.Sprintf("Chunk starts at %d, expected %d", start, received))
+			return
+		}
+
+		// Chunks can be resent, we only keep what we don't have yet
+		if skip := received - start; skip < int64(len(data)) {
+			up.content.Write(data[skip:])
+		}
+	}
+
+	received = int64(up.content.Len())
+
+	if total < 0 || received < total {
+		// The upload isn't complete, we tell the client how much we have
+		if received > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+		}
+
+		if r.Header.Get("X-GUploader-No-308") == "yes" {
+			w.Header().Set("X-HTTP-Status-Code-Override", "308")
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+
+		return
+	}
+
+	up.done = true
+	delete(s.uploads, uploadID)
+
+	r.Form.Set("addParents", up.addParents)
+	r.Form.Set("removeParents", up.removeParents)
+	r.Form.Set("fields", up.fields)
+
+	s.finishUpload(w, r, up.fileID, up.metadata, up.content.Bytes(), r.Header.Get("Content-Type"))
+}
+
+// parseContentRange parses "bytes 0-99/1000", "bytes 0-99/*" or "bytes */1000".
+// It returns the start offset (-1 if no data is sent) and the total size (-1 if unknown).
+func parseContentRange(header string) (int64, int64, error) {
+	if header == "" {
+		return -1, -1, nil
+	}
+
+	spec := strings.TrimPrefix(header, "bytes ")
+	slash := strings.LastIndex(spec, "/")
+
+	if spec == header || slash < 0 {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+	}
+
+	start, total := int64(-1), int64(-1)
+
+	var err error
+
+	if totalStr := spec[slash+1:]; totalStr != "*" {
+		if total, err = strconv.ParseInt(totalStr, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+		}
+	}
+
+	if rangeStr := spec[:slash]; rangeStr != "*" {
+		bounds := strings.SplitN(rangeStr, "-", 2)
+		if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range: %s", header)
+		}
+	}
+
+	return start, total, nil
+}
@@ -0,0 +1,234 @@
+package gdrive // nolint: golint
+
+import (
+	"path"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// DuplicatePolicy defines how the files having the same name in a folder are handled. Google Drive allows it, but
+// a path can only lead to one of them.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesError makes the paths leading to several files fail with a FileHasMultipleEntriesError, they are all
+	// listed
+	DuplicatesError DuplicatePolicy = iota
+	// DuplicatesNewest makes the paths lead to the most recently modified file, the other ones are hidden
+	DuplicatesNewest
+	// DuplicatesOldest makes the paths lead to the least recently modified file, the other ones are hidden
+	DuplicatesOldest
+	// DuplicatesRename lists all the files: the first one created keeps its name, the other ones get a suffix made
+	// of the end of their ID (like "name~1a2b3c4d.ext") that can be used in the paths
+	DuplicatesRename
+)
+
+// duplicateSeparator separates the name of a duplicate from the end of its ID
+const duplicateSeparator = "~"
+
+// duplicateIDLength is the number of characters of the ID used to disambiguate a duplicate. The IDs are random, so
+// the end of an ID is as unique as its start.
+const duplicateIDLength = 8
+
+// duplicateFields are the fields needed to choose among the duplicates
+const duplicateFields = "createdTime,id,modifiedTime,name"
+
+// withDuplicateFields adds the fields needed to choose among the duplicates to the fields of a lookup
+func withDuplicateFields(fields googleapi.Field) googleapi.Field {
+	inner := strings.TrimSuffix(strings.TrimPrefix(string(fields), "files("), ")")
+	if inner == "" {
+		inner = "mimeType,parents"
+	}
+
+	return googleapi.Field("files(" + inner + "," + duplicateFields + ")")
+}
+
+// duplicateSuffix returns the suffix of the name of a duplicate
+func duplicateSuffix(file *drive.File) string {
+	id := file.Id
+	if len(id) > duplicateIDLength {
+		id = id[len(id)-duplicateIDLength:]
+	}
+
+	return duplicateSeparator + id
+}
+
+// withSuffix inserts a suffix in a name, before its extension
+func withSuffix(name, suffix string) string {
+	ext := path.Ext(name)
+
+	return name[:len(name)-len(ext)] + suffix + ext
+}
+
+// parseDuplicateName splits the name of a duplicate into the name of the file and the end of its ID
+func parseDuplicateName(name string) (string, string, bool) {
+	ext := path.Ext(name)
+	stem := name[:len(name)-len(ext)]
+
+	i := strings.LastIndex(stem, duplicateSeparator)
+	if i < 0 || len(stem)-i-len(duplicateSeparator) < duplicateIDLength {
+		return "", "", false
+	}
+
+	idStart := i + len(duplicateSeparator)
+
+	// The ID might have been inserted before a dot in the name of a document, followed by its export extension
+	return stem[:i] + stem[idStart+duplicateIDLength:] + ext, stem[idStart : idStart+duplicateIDLength], true
+}
+
+// chosenDuplicate returns the file that keeps the name among the files having it
+func (d *GDriver) chosenDuplicate(files []*drive.File) *drive.File {
+	chosen := files[0]
+
+	for _, f := range files[1:] {
+		var before bool
+
+		switch d.Duplicates {
+		case DuplicatesNewest:
+			before = f.ModifiedTime > chosen.ModifiedTime || f.ModifiedTime == chosen.ModifiedTime && f.Id < chosen.Id
+		case DuplicatesOldest:
+			before = f.ModifiedTime < chosen.ModifiedTime || f.ModifiedTime == chosen.ModifiedTime && f.Id < chosen.Id
+		default:
+			// The creation time doesn't change, so the names don't change when the files are modified
+			before = f.CreatedTime < chosen.CreatedTime || f.CreatedTime == chosen.CreatedTime && f.Id < chosen.Id
+		}
+
+		if before {
+			chosen = f
+		}
+	}
+
+	return chosen
+}
+
+// findFile looks for the file a name leads to in a folder, according to the DuplicatePolicy. The documents can be
+// looked for with the extension of their export format. It returns the file (nil if there's none) and the suffix of
+// its name if it's a renamed duplicate.
+func (d *GDriver) findFile(
+	folder *drive.File,
+	name string,
+	fields googleapi.Field,
+	exported bool,
+	filePath string,
+) (*drive.File, string, error) {
+	if d.Duplicates != DuplicatesError {
+		fields = withDuplicateFields(fields)
+	}
+
+	files, err := d.lookupFiles(folder, name, fields, exported)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case len(files) == 1:
+		return files[0], "", nil
+	case len(files) > 1 && d.Duplicates == DuplicatesError:
+		return nil, "", &FileHasMultipleEntriesError{Path: filePath}
+	case len(files) > 1:
+		return d.chosenDuplicate(files), "", nil
+	}
+
+	if d.Duplicates != DuplicatesRename {
+		return nil, "", nil
+	}
+
+	// The name might be the one of a renamed duplicate
+	original, idEnd, ok := parseDuplicateName(name)
+	if !ok {
+		return nil, "", nil
+	}
+
+	if files, err = d.lookupFiles(folder, original, fields, exported); err != nil || len(files) < 2 {
+		return nil, "", err
+	}
+
+	chosen := d.chosenDuplicate(files)
+
+	var found *drive.File
+
+	for _, f := range files {
+		if f != chosen && duplicateSuffix(f) == duplicateSeparator+idEnd {
+			if found != nil {
+				return nil, "", &FileHasMultipleEntriesError{Path: filePath}
+			}
+
+			found = f
+		}
+	}
+
+	if found == nil {
+		return nil, "", nil
+	}
+
+	return found, duplicateSuffix(found), nil
+}
+
+// lookupFiles returns the files having a name in a folder, or the documents having it with their export extension
+func (d *GDriver) lookupFiles(
+	folder *drive.File,
+	name string,
+	fields googleapi.Field,
+	exported bool,
+) ([]*drive.File, error) {
+	files, err := d.getFileByFolderAndName(folder, name, fields)
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	if files != nil && len(files.Files) > 0 || !exported {
+		if files == nil {
+			return nil, nil
+		}
+
+		return files.Files, nil
+	}
+
+	found, err := d.getExportedFiles(folder, name)
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	return found, nil
+}
+
+// folderEntries returns the FileInfo of the children of a folder, the duplicates being hidden or renamed according
+// to the DuplicatePolicy
+func (d *GDriver) folderEntries(files []*drive.File, parentPath string) []*FileInfo {
+	var groups map[string][]*drive.File
+
+	if d.Duplicates != DuplicatesError {
+		groups = make(map[string][]*drive.File, len(files))
+
+		for _, f := range files {
+			key := strings.ToLower(f.Name)
+			groups[key] = append(groups[key], f)
+		}
+	}
+
+	entries := make([]*FileInfo, 0, len(files))
+
+	for _, f := range files {
+		if d.HideGoogleDocs && isGoogleDoc(f) {
+			continue
+		}
+
+		suffix := ""
+
+		if group := groups[strings.ToLower(f.Name)]; len(group) > 1 && d.chosenDuplicate(group) != f {
+			if d.Duplicates != DuplicatesRename {
+				continue
+			}
+
+			suffix = duplicateSuffix(f)
+		}
+
+		fi := d.newFileInfo(f, parentPath)
+		fi.suffix = suffix
+		entries = append(entries, fi)
+	}
+
+	return entries
+}
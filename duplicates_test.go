@@ -0,0 +1,126 @@
+package gdrive
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestParseDuplicateName(t *testing.T) {
+	for name, expected := range map[string][]string{
+		"report~1a2b3c4d.pdf":  {"report.pdf", "1a2b3c4d"},
+		"folder~1a2b3c4d":      {"folder", "1a2b3c4d"},
+		"notes~1a2b3c4d.b.odt": {"notes.b.odt", "1a2b3c4d"},
+	} {
+		original, id, ok := parseDuplicateName(name)
+		require.True(t, ok, name)
+		require.Equal(t, expected, []string{original, id}, name)
+	}
+
+	for _, name := range []string{"report.pdf", "report~1a2b.pdf", "~.pdf"} {
+		_, _, ok := parseDuplicateName(name)
+		require.False(t, ok, name)
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	driver := setup(t)
+
+	// The driver doesn't create duplicates, but other clients can
+	var ids []string
+
+	for _, content := range []string{"first", "second", "third"} {
+		time.Sleep(2 * time.Millisecond)
+
+		file, err := driver.srv.Files.Create(&drive.File{Name: "File.txt", Parents: []string{driver.rootNode.file.Id}}).
+			Media(bytes.NewBufferString(content)).Do()
+		require.NoError(t, err)
+
+		ids = append(ids, file.Id)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := driver.srv.Files.Create(&drive.File{
+			Name:     "Folder",
+			MimeType: mimeTypeFolder,
+			Parents:  []string{driver.rootNode.file.Id},
+		}).Do()
+		require.NoError(t, err)
+	}
+
+	listNames := func(t *testing.T, path string) []string {
+		dir, err := driver.Open(path)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, dir.Close()) }()
+
+		names, err := dir.Readdirnames(0)
+		require.NoError(t, err)
+		sort.Strings(names)
+
+		return names
+	}
+
+	t.Run("error", func(t *testing.T) {
+		var multiple *FileHasMultipleEntriesError
+
+		_, err := driver.Stat("File.txt")
+		require.True(t, errors.As(err, &multiple))
+		require.Equal(t, "File.txt", multiple.Path)
+
+		require.Equal(t, []string{"File.txt", "File.txt", "File.txt", "Folder", "Folder"}, listNames(t, "/"))
+	})
+
+	t.Run("newest", func(t *testing.T) {
+		driver.Duplicates = DuplicatesNewest
+
+		mustReadFileContent(t, driver, "File.txt", "third")
+		require.Equal(t, []string{"File.txt", "Folder"}, listNames(t, "/"))
+	})
+
+	t.Run("oldest", func(t *testing.T) {
+		driver.Duplicates = DuplicatesOldest
+
+		mustReadFileContent(t, driver, "File.txt", "first")
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		driver.Duplicates = DuplicatesRename
+
+		second := withSuffix("File.txt", duplicateSuffix(&drive.File{Id: ids[1]}))
+		third := withSuffix("File.txt", duplicateSuffix(&drive.File{Id: ids[2]}))
+
+		names := listNames(t, "/")
+		require.Len(t, names, 5)
+		require.Subset(t, names, []string{"File.txt", second, third, "Folder"})
+
+		mustReadFileContent(t, driver, "File.txt", "first")
+		mustReadFileContent(t, driver, second, "second")
+		mustReadFileContent(t, driver, third, "third")
+
+		fi, err := driver.Stat(third)
+		require.NoError(t, err)
+		require.Equal(t, third, fi.Name())
+
+		// The paths can go through the renamed folders
+		for _, name := range names {
+			if strings.HasPrefix(name, "Folder~") {
+				require.NoError(t, driver.MkdirAll(name+"/Sub", os.FileMode(0700)))
+				mustWriteFile(t, driver, name+"/Sub/File")
+				require.Equal(t, []string{"Sub"}, listNames(t, name))
+			}
+		}
+
+		require.Empty(t, listNames(t, "Folder"))
+
+		_, err = driver.Stat("File~00000000.txt")
+		require.True(t, IsNotExist(err))
+	})
+}
@@ -23,18 +23,42 @@ var ErrReadOnly = errors.New("we're in a read-only mode")
 // ErrWriteOnly means a write operation was performed on a file opened in write-only
 var ErrWriteOnly = errors.New("we're in write-only mode")
 
+// ErrInvalidSize is returned when a file is truncated to a negative size
+var ErrInvalidSize = errors.New("invalid size")
+
 // ErrOpenMissingFlag is returned when neither read nor write flags are passed
 var ErrOpenMissingFlag = errors.New("you need to specify a read or write flag")
 
 // ErrUnknownBufferType is returned when a un unknown buffer is specified
 var ErrUnknownBufferType = errors.New("unknown buffer type")
 
+// ErrUnknownHashMethod is returned when an unknown hash method is specified
+var ErrUnknownHashMethod = errors.New("unknown hash method")
+
+// ErrUploadSessionExpired is returned when a resumable upload session doesn't exist anymore
+var ErrUploadSessionExpired = errors.New("upload session expired")
+
+// ErrInvalidUploadSession is returned when a resumable upload session can't be used
+var ErrInvalidUploadSession = errors.New("invalid upload session")
+
+// ErrUploadIncomplete is returned when Google Drive doesn't acknowledge the data of a resumable upload
+var ErrUploadIncomplete = errors.New("upload data wasn't acknowledged")
+
+// ErrNotExportable is returned when a Google-native document is read but no export format is defined for it
+var ErrNotExportable = errors.New("no export format for this google document")
+
+// ErrCacheStoreClosed is returned when a closed cache store is updated
+var ErrCacheStoreClosed = errors.New("cache store is closed")
+
 // ErrEmptyPath is returned when an empty path is sent
 var ErrEmptyPath = errors.New("path cannot be empty")
 
 // ErrForbiddenOnRoot is returned when an operation is performed on the root node
 var ErrForbiddenOnRoot = errors.New("forbidden for root directory")
 
+// ErrMissingPermissionID is returned when a permission is updated without its ID
+var ErrMissingPermissionID = errors.New("the permission doesn't have an ID")
+
 // errInternalNil is an internal error and it should never be reported
 var errInternalNil = errors.New("internal nil error")
 
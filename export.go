@@ -0,0 +1,192 @@
+package gdrive // nolint: golint
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Mime types of the Google-native documents, which can't be downloaded but only exported
+const (
+	MimeTypeDocument     = "application/vnd.google-apps.document"
+	MimeTypeSpreadsheet  = "application/vnd.google-apps.spreadsheet"
+	MimeTypePresentation = "application/vnd.google-apps.presentation"
+	MimeTypeDrawing      = "application/vnd.google-apps.drawing"
+
+	mimeTypeApps = "application/vnd.google-apps."
+)
+
+// ExportFormat is a format Google-native documents can be exported to
+type ExportFormat struct {
+	MimeType  string // MimeType is the mime type of the exported file
+	Extension string // Extension is appended to the name of the document, like ".docx"
+}
+
+// Some of the formats supported by Google Drive for the exports
+var (
+	ExportDocx     = ExportFormat{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"}
+	ExportXlsx     = ExportFormat{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"}
+	ExportPptx     = ExportFormat{"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"}
+	ExportODT      = ExportFormat{"application/vnd.oasis.opendocument.text", ".odt"}
+	ExportODS      = ExportFormat{"application/vnd.oasis.opendocument.spreadsheet", ".ods"}
+	ExportODP      = ExportFormat{"application/vnd.oasis.opendocument.presentation", ".odp"}
+	ExportPDF      = ExportFormat{"application/pdf", ".pdf"}
+	ExportMarkdown = ExportFormat{"text/markdown", ".md"}
+	ExportText     = ExportFormat{"text/plain", ".txt"}
+	ExportCSV      = ExportFormat{"text/csv", ".csv"} // Only the first sheet is exported
+	ExportPNG      = ExportFormat{"image/png", ".png"}
+	ExportSVG      = ExportFormat{"image/svg+xml", ".svg"}
+)
+
+// DefaultExportFormats are the formats used by default to export the Google-native documents
+var DefaultExportFormats = map[string]ExportFormat{
+	MimeTypeDocument:     ExportDocx,
+	MimeTypeSpreadsheet:  ExportXlsx,
+	MimeTypePresentation: ExportPptx,
+	MimeTypeDrawing:      ExportPNG,
+}
+
+// exportsCacheMaxBytes is the size of the exports kept in memory, for the ranged reads of the documents
+const exportsCacheMaxBytes = 64 << 20
+
+// exportSizesCacheMaxEntries is the number of export sizes kept, to give the size of the documents already exported
+const exportSizesCacheMaxEntries = 10000
+
+// exportLookupFields are the fields fetched when looking for a document by its exported name
+var exportLookupFields = googleapi.Field("files(createdTime,driveId,id,mimeType,modifiedTime,name,parents,size)")
+
+// isGoogleDoc returns true for the Google-native files (documents, spreadsheets, forms, etc.), but not the folders
+func isGoogleDoc(file *drive.File) bool {
+	return strings.HasPrefix(file.MimeType, mimeTypeApps) && file.MimeType != mimeTypeFolder
+}
+
+// newFileInfo creates the FileInfo of a file, with its export format if it's a Google-native document
+func (d *GDriver) newFileInfo(file *drive.File, parentPath string) *FileInfo {
+	fi := &FileInfo{
+		file:       file,
+		parentPath: parentPath,
+		sharing:    d.ModeSharing,
+	}
+
+	if format, ok := d.ExportFormats[file.MimeType]; ok {
+		fi.export = &format
+
+		if size, ok := d.exportSizes.Get(exportKey(file, &format)); ok {
+			fi.setExportSize(size.(int64))
+		}
+	}
+
+	return fi
+}
+
+// exportKey identifies the export of a version of a document to a format
+func exportKey(file *drive.File, format *ExportFormat) string {
+	return fmt.Sprintf("%s-%s-%s", file.Id, file.ModifiedTime, format.MimeType)
+}
+
+// trimExtension removes the extension of a name (whatever its case), if the name has it
+func trimExtension(name, extension string) (string, bool) {
+	if extension == "" || len(name) <= len(extension) ||
+		!strings.EqualFold(name[len(name)-len(extension):], extension) {
+		return name, false
+	}
+
+	return name[:len(name)-len(extension)], true
+}
+
+// getExportedFiles looks for the documents whose name with the extension of their export format is fileName
+func (d *GDriver) getExportedFiles(folder *drive.File, fileName string) ([]*drive.File, error) {
+	var found []*drive.File
+
+	for mimeType, format := range d.ExportFormats {
+		name, ok := trimExtension(fileName, format.Extension)
+		if !ok {
+			continue
+		}
+
+		files, err := d.getFileByFolderAndName(folder, name, exportLookupFields)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files.Files {
+			if file.MimeType == mimeType {
+				found = append(found, file)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// exportFile exports a document. The whole export is fetched: Google Drive limits them to 10MB. It's kept in memory
+// until the document is modified, the ranged reads don't export it again.
+func (d *GDriver) exportFile(fi *FileInfo) ([]byte, error) {
+	key := exportKey(fi.file, fi.export)
+
+	if content, ok := d.exports.Get(key); ok {
+		return content.([]byte), nil
+	}
+
+	request := d.srv.Files.Export(fi.file.Id, fi.export.MimeType)
+
+	var response *http.Response
+
+	err := d.callAPI(CallRead, true, func() error {
+		var err error
+		response, err = request.Context(d.Context()).Download() // nolint:bodyclose
+
+		return err
+	})
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	defer func() {
+		if errClose := response.Body.Close(); errClose != nil {
+			d.Logger.Warn("Couldn't close export stream", "err", errClose)
+		}
+	}()
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &DriveStreamError{Err: err}
+	}
+
+	fi.setExportSize(int64(len(content)))
+	d.exportSizes.Set(key, int64(len(content)))
+	d.exports.Set(key, content)
+
+	return content, nil
+}
+
+// getExportRangeReader exports a document and returns a reader from the offset start to the offset end
+// (inclusive), or the end of the export if end is negative
+func (d *GDriver) getExportRangeReader(fi *FileInfo, start, end int64) (io.ReadCloser, error) {
+	content, err := d.exportFile(fi)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(content))
+
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+
+	if start > size {
+		start = size
+	}
+
+	if end < start {
+		end = start - 1
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(content[start : end+1])), nil
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 
 	"github.com/spf13/afero"
+
+	"github.com/jonny5532/afero-gdrive/iohelper"
 )
 
 // AsAfero provides a cast to afero interface for easier testing
@@ -17,18 +19,40 @@ func (f *File) AsAfero() afero.File {
 
 // File represents the managed file structure
 type File struct {
-	*FileInfo                     // FileInfo contains the core fileInfo
-	Path           string         // Path is the complete path of hte file
-	driver         *GDriver       // driver is a reference to the parent driver
-	streamRead     io.ReadCloser  // streamRead is the underlying reading stream
-	streamWrite    io.WriteCloser // streamWrite is the underlying writing stream
-	streamWriteEnd chan error     // streamWriteEnd is a channel returning the error of the underlying write stream
-	streamOffset   int64          // streamOffset is the position of the stream
-	dirListToken   string         // dirListToken contains the token used to list files
+	*FileInfo                          // FileInfo contains the core fileInfo
+	Path           string              // Path is the complete path of hte file
+	driver         *GDriver            // driver is a reference to the parent driver
+	streamRead     io.ReadCloser       // streamRead is the underlying reading stream
+	streamWrite    io.WriteCloser      // streamWrite is the underlying writing stream
+	streamWriteEnd chan error          // streamWriteEnd is a channel returning the error of the underlying write stream
+	streamOffset   int64               // streamOffset is the position of the stream
+	dirListToken   string              // dirListToken contains the token used to list files
+	dirEntries     []*FileInfo         // dirEntries contains the files that remain to be listed from a cached listing
+	spool          *iohelper.SpoolFile // spool is the local copy of the file, when random access is needed
+	spoolDirty     bool                // spoolDirty is set when the local copy has changes to upload
+	spoolAppend    bool                // spoolAppend is set when all writes go to the end of the file
+	spoolRead      bool                // spoolRead is set when the local copy can be read
+	upload         *resumableWriter    // upload is the resumable upload, when they are enabled
+}
+
+// UploadSession returns the session of the resumable upload of the file, if any. It can be persisted to resume the
+// upload with GDriver.ResumeUpload.
+func (f *File) UploadSession() *UploadSession {
+	if f.upload == nil {
+		return nil
+	}
+
+	session := *f.upload.session
+
+	return &session
 }
 
 // Seek sets the offset for the next Read or Write to offset
 func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.spool != nil {
+		return f.seekSpool(offset, whence)
+	}
+
 	// Write seek is not supported by the google drive API.
 	if f.streamWrite != nil {
 		return 0, ErrNotImplemented
@@ -43,42 +67,90 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 	return 0, afero.ErrFileClosed
 }
 
+// seekRead moves the read position. It's lazy: the download is only moved or re-opened by the next read.
 func (f *File) seekRead(offset int64, whence int) (int64, error) {
-	startByte := int64(0)
-
 	switch whence {
 	case io.SeekStart:
-		startByte = offset
 	case io.SeekCurrent:
-		startByte = f.streamOffset + offset
+		offset += f.streamOffset
 	case io.SeekEnd:
-		startByte = f.FileInfo.Size() - offset
+		offset += f.FileInfo.Size()
+	default:
+		return 0, ErrInvalidSeek
 	}
 
-	if err := f.streamRead.Close(); err != nil {
-		return 0, fmt.Errorf("couldn't close previous stream: %w", err)
+	if offset < 0 {
+		return 0, ErrInvalidSeek
 	}
 
-	f.streamRead = nil
+	if reader, ok := f.streamRead.(seeker); ok {
+		reader.seek(offset)
+	} else {
+		if err := f.streamRead.Close(); err != nil {
+			return 0, fmt.Errorf("couldn't close previous stream: %w", err)
+		}
 
-	if startByte < 0 {
-		return startByte, ErrInvalidSeek
+		f.streamRead = f.driver.newStreamReader(f.FileInfo, offset)
 	}
 
-	var err error
+	f.streamOffset = offset
 
-	f.streamRead, err = f.driver.getFileReader(f.FileInfo, startByte)
+	return offset, nil
+}
 
-	return startByte, err
+func (f *File) seekSpool(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.streamOffset
+	case io.SeekEnd:
+		offset += f.spool.Size()
+	default:
+		return 0, ErrInvalidSeek
+	}
+
+	if offset < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	f.streamOffset = offset
+
+	return offset, nil
 }
 
-// ReadAt reads a file at a specific offset
+// ReadAt reads len(p) bytes of a file at a specific offset. The reads are independent ranged downloads (or hits of the
+// content cache), so they don't move the offset of Read and can be done concurrently.
 func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
-	if _, err := f.Seek(off, 0); err != nil {
-		return 0, err
+	if f.spool != nil {
+		if !f.spoolRead {
+			return 0, ErrWriteOnly
+		}
+
+		return f.spool.ReadAt(p, off)
 	}
 
-	return f.Read(p)
+	if f.streamWrite != nil {
+		return 0, ErrWriteOnly
+	}
+
+	if f.streamRead == nil {
+		return 0, afero.ErrFileClosed
+	}
+
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	if reader, ok := f.streamRead.(*cachedReader); ok {
+		n, err := reader.ReadAt(p, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			err = &DriveStreamError{Err: err}
+		}
+
+		return n, err
+	}
+
+	return f.driver.readFileAt(f.FileInfo, p, off)
 }
 
 // Readdir provides a list of file information
@@ -88,13 +160,13 @@ func (f *File) Readdir(count int) ([]os.FileInfo, error) {
 
 // Readdirnames provides a list of directory names
 func (f *File) Readdirnames(n int) ([]string, error) {
-	names := make([]string, n, 0)
-
 	dirs, err := f.Readdir(n)
 	if err != nil {
 		return nil, err
 	}
 
+	names := make([]string, 0, len(dirs))
+
 	for _, d := range dirs {
 		names = append(names, d.Name())
 	}
@@ -102,13 +174,63 @@ func (f *File) Readdirnames(n int) ([]string, error) {
 	return names, nil
 }
 
-// Truncate should truncate a file to a specific size. But this method is not supported by
-// the google drive API.
-func (f *File) Truncate(int64) error {
-	return ErrNotSupported
+// Truncate changes the size of the file. As it's not supported by the google drive API, the file is rewritten
+// (or only its local copy for spooled files).
+func (f *File) Truncate(size int64) error {
+	if f.spool != nil {
+		if err := f.spool.Truncate(size); err != nil {
+			return err
+		}
+
+		f.spoolDirty = true
+
+		return nil
+	}
+
+	// A write stream replaces the whole content, so it's only truncated if we are at the right place
+	if f.streamWrite != nil {
+		if size == f.streamOffset {
+			return nil
+		}
+
+		return ErrNotSupported
+	}
+
+	// The revisions can't be changed
+	if f.revision != "" {
+		return ErrReadOnly
+	}
+
+	if err := f.driver.truncateFile(f.FileInfo, size); err != nil {
+		return err
+	}
+
+	if f.streamRead == nil {
+		return nil
+	}
+
+	// The read stream is re-opened on the new content
+	if err := f.streamRead.Close(); err != nil {
+		return &DriveStreamError{Err: err}
+	}
+
+	if f.driver.cachesContent(f.FileInfo) {
+		f.streamRead = f.driver.newCachedReader(f.FileInfo, f.streamOffset)
+	} else {
+		f.streamRead = f.driver.newStreamReader(f.FileInfo, f.streamOffset)
+	}
+
+	return nil
 }
 
 func (f *File) Read(p []byte) (int, error) {
+	if f.spool != nil {
+		n, err := f.ReadAt(p, f.streamOffset)
+		f.streamOffset += int64(n)
+
+		return n, err
+	}
+
 	if f.streamWrite != nil {
 		return 0, ErrWriteOnly
 	}
@@ -124,6 +246,17 @@ func (f *File) Read(p []byte) (int, error) {
 }
 
 func (f *File) Write(p []byte) (int, error) {
+	if f.spool != nil {
+		if f.spoolAppend {
+			f.streamOffset = f.spool.Size()
+		}
+
+		n, err := f.WriteAt(p, f.streamOffset)
+		f.streamOffset += int64(n)
+
+		return n, err
+	}
+
 	if f.streamRead != nil {
 		return 0, ErrReadOnly
 	}
@@ -140,6 +273,11 @@ func (f *File) Write(p []byte) (int, error) {
 
 // WriteAt writes some bytes at a specified offset
 func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	if f.spool != nil {
+		f.spoolDirty = true
+		return f.spool.WriteAt(p, off)
+	}
+
 	if _, err := f.Seek(off, 0); err != nil {
 		return 0, err
 	}
@@ -155,6 +293,26 @@ func (f *File) WriteString(s string) (ret int, err error) {
 // Close closes the file
 // This marks the end of the file write.
 func (f *File) Close() error {
+	if f.spool != nil {
+		err := f.Sync()
+
+		if errClose := f.spool.Close(); err == nil {
+			err = errClose
+		}
+
+		f.spool = nil
+
+		return err
+	}
+
+	// Resumable uploads are performed synchronously
+	if f.upload != nil && f.streamWrite != nil {
+		err := f.streamWrite.Close()
+		f.streamWrite = nil
+
+		return err
+	}
+
 	if f.streamWrite != nil {
 		err := f.streamWrite.Close()
 		if err != nil {
@@ -180,10 +338,31 @@ func (f *File) Close() error {
 
 // Stat provides stat file information
 func (f *File) Stat() (os.FileInfo, error) {
+	if f.spool != nil {
+		// The FileInfo and its drive.File are shared with the cached listings, the size is only set on copies
+		file := *f.file
+		file.Size = f.spool.Size()
+
+		info := *f.FileInfo
+		info.file = &file
+
+		return &info, nil
+	}
+
 	return f.FileInfo, nil
 }
 
-// Sync forces a file synchronization. This has no effect here.
+// Sync forces a file synchronization. This only has an effect on spooled files, whose changes are uploaded.
 func (f *File) Sync() error {
+	if f.spool == nil || !f.spoolDirty {
+		return nil
+	}
+
+	if err := f.driver.uploadSpool(f); err != nil {
+		return err
+	}
+
+	f.spoolDirty = false
+
 	return nil
 }
@@ -3,6 +3,8 @@ package gdrive // nolint: golint
 import (
 	"os"
 	"path"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	drive "google.golang.org/api/drive/v3"
@@ -10,22 +12,74 @@ import (
 
 const mimeFolder = "application/vnd.google-apps.folder"
 
+// modeProperty is the property storing the mode set with Chmod
+const modeProperty = "ftp_file_mode"
+
 // FileInfo represents File information for a File or directory
 type FileInfo struct {
+	exportSize int64 // exportSize is the size of the export once it's known, accessed atomically (first for alignment)
 	file       *drive.File
 	parentPath string
+	export     *ExportFormat // export is the format Google-native documents are exported to
+	suffix     string        // suffix disambiguates the name of a file among the files having the same name
+	sharing    bool          // sharing makes the mode reflect the sharing of the File (see the ModeSharing option)
+	revision   string        // revision is the ID of the revision whose content is read, the head one if empty
 }
 
-// Mode returns the file mode bits
+// Mode returns the file mode bits: the permissions set with Chmod, or by default read and write for the owner
+// (read only if the File can't be edited) and read for the others, the directories being executable. With the
+// ModeSharing option, the write bits are only kept if the File can be edited and the read bit of the others tells
+// whether it's shared with anyone having the link.
 func (i *FileInfo) Mode() os.FileMode {
-	mode := os.FileMode(0)
+	mode := os.FileMode(0644)
+
+	if !i.canEdit() {
+		mode = 0444
+	}
+
+	if stored, err := strconv.ParseUint(i.file.Properties[modeProperty], 10, 32); err == nil {
+		mode = os.FileMode(stored).Perm()
+	}
+
+	if i.sharing {
+		if !i.canEdit() {
+			mode &^= 0222
+		}
+
+		mode &^= 0004
+
+		if i.sharedWithAnyone() {
+			mode |= 0004
+		}
+	}
+
 	if i.file.MimeType == mimeFolder {
+		if i.file.Properties[modeProperty] == "" {
+			mode |= 0111
+		}
+
 		mode |= os.ModeDir
 	}
 
 	return mode
 }
 
+// canEdit returns true if the File can be edited, or if it isn't known
+func (i *FileInfo) canEdit() bool {
+	return i.file.Capabilities == nil || i.file.Capabilities.CanEdit
+}
+
+// sharedWithAnyone returns true if anyone having the link can access the File
+func (i *FileInfo) sharedWithAnyone() bool {
+	for _, id := range i.file.PermissionIds {
+		if id == anyoneWithLinkID || id == anyoneID {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ModTime returns the modification time
 func (i *FileInfo) ModTime() time.Time {
 	modifiedTime, _ := time.Parse(time.RFC3339, i.file.ModifiedTime)
@@ -38,6 +92,19 @@ func (i *FileInfo) CreateTime() time.Time {
 	return t
 }
 
+// TrashedTime returns the time when this File was trashed, it's zero if it isn't trashed or wasn't listed from the
+// trash
+func (i *FileInfo) TrashedTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, i.file.TrashedTime)
+	return t
+}
+
+// TrashingUser returns the user who trashed this File, nil if it isn't known (Google Drive only gives it for the files
+// of the shared drives)
+func (i *FileInfo) TrashingUser() *drive.User {
+	return i.file.TrashingUser
+}
+
 // Sys provides underlying data source
 func (i *FileInfo) Sys() interface{} {
 	return i.file
@@ -45,7 +112,21 @@ func (i *FileInfo) Sys() interface{} {
 
 // Name returns the name of the File or directory
 func (i *FileInfo) Name() string {
-	return sanitizeName(i.file.Name)
+	name := sanitizeName(i.file.Name)
+
+	if i.suffix != "" {
+		name = withSuffix(name, i.suffix)
+	}
+
+	if i.export == nil {
+		return name
+	}
+
+	if _, ok := trimExtension(name, i.export.Extension); !ok {
+		name += i.export.Extension
+	}
+
+	return name
 }
 
 // ParentPath returns the parent path of the File or directory
@@ -58,11 +139,21 @@ func (i *FileInfo) Path() string {
 	return path.Join(i.parentPath, i.Name())
 }
 
-// Size returns the bytes for this File
+// Size returns the bytes for this File. The size of the exported documents is only known once they were exported: it's
+// 0 in the listings until then, or once many other documents were exported since.
 func (i *FileInfo) Size() int64 {
+	if i.export != nil {
+		return atomic.LoadInt64(&i.exportSize)
+	}
+
 	return i.file.Size
 }
 
+// setExportSize sets the size of the export, the concurrent reads of the File can export it
+func (i *FileInfo) setExportSize(size int64) {
+	atomic.StoreInt64(&i.exportSize, size)
+}
+
 // IsDir returns true if this File is a directory
 func (i *FileInfo) IsDir() bool {
 	return i.file.MimeType == mimeTypeFolder
@@ -2,10 +2,20 @@
 package gdrive
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"  // nolint: gosec
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strings"
@@ -17,6 +27,8 @@ import (
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
+	"github.com/jonny5532/afero-gdrive/blockcache"
+	"github.com/jonny5532/afero-gdrive/cache"
 	"github.com/jonny5532/afero-gdrive/iohelper"
 	"github.com/jonny5532/afero-gdrive/log"
 )
@@ -37,38 +49,69 @@ const (
 
 // GDriver can be used to access google drive in a traditional File-folder-path pattern
 type GDriver struct {
-	srv                 *drive.Service
-	rootNodeId			string
-	rootNode            *FileInfo
-	Logger              log.Logger
-	LogReaderAndWriters bool
-	TrashForDelete      bool
-	WriteBufferType     WriteBufferType
-	WriteBufferSize     int
-	srvWrapper          *APIWrapper
+	srv                       *drive.Service
+	rootNodeId                string
+	rootNode                  *FileInfo
+	Logger                    log.Logger
+	LogReaderAndWriters       bool
+	TrashForDelete            bool
+	WriteBufferType           WriteBufferType
+	WriteBufferSize           int
+	SpoolFiles                bool
+	SpoolMemoryLimit          int64
+	SpoolDirectory            string
+	UploadChunkSize           int
+	UploadProgress            func(path string, session UploadSession)
+	ExportFormats             map[string]ExportFormat
+	HideGoogleDocs            bool
+	SharedDrives              bool
+	srvWrapper                *APIWrapper
+	client                    *http.Client
+	ctx                       context.Context
+	rateLimiter               RateLimiter
+	retryPolicy               *RetryPolicy
+	exportSizes               *cache.Cache
+	exports                   *cache.Cache
+	contentCache              *blockcache.Cache
+	ContentBlockSize          int64
+	ReadAheadRanges           int
+	ReadAheadSize             int64
+	ParallelDownloadThreshold int64
+	ParallelDownloadWorkers   int
+	ParallelDownloadRangeSize int64
+	Duplicates                DuplicatePolicy
+	ModeSharing               bool
 }
 
 // HashMethod is the hashing method to use for GetFileHash
 type HashMethod int
 
+const (
+	// HashMethodMD5 uses the MD5 checksum
+	HashMethodMD5 HashMethod = iota
+	// HashMethodSHA1 uses the SHA-1 checksum
+	HashMethodSHA1
+	// HashMethodSHA256 uses the SHA-256 checksum
+	HashMethodSHA256
+)
+
 const (
 	mimeTypeFolder = "application/vnd.google-apps.folder"
 	mimeTypeFile   = "application/octet-stream"
-
-	// We should probably ignore these types of files:
-	// mimeTypeDocument     = "application/vnd.google-apps.document"
-	// mimeTypeSpreadsheet  = "application/vnd.google-apps.spreadsheet"
-	// mimeTypePresentation = "application/vnd.google-apps.presentation"
-	// mimeTypeDrawing      = "application/vnd.google-apps.drawing"
 )
 
 var (
 	fileInfoFields = []googleapi.Field{
+		"capabilities(canEdit)",
 		"createdTime",
+		"driveId",
 		"id",
+		"md5Checksum",
 		"mimeType",
 		"modifiedTime",
 		"name",
+		"permissionIds",
+		"properties",
 		"size",
 	}
 	listFields     []googleapi.Field
@@ -81,34 +124,18 @@ func sharedInit() {
 	}
 }
 
-var mutex sync.Mutex
-var queryTimes []int64
-func RateLimit() {
-	mutex.Lock()
-
-	const MAX_API_CALLS_PER_SECOND = 4
-
-	queryTimes = append(queryTimes, time.Now().UnixNano())
-
-	if len(queryTimes)>=MAX_API_CALLS_PER_SECOND {
-		elapsed := queryTimes[len(queryTimes)-1] - queryTimes[len(queryTimes)-MAX_API_CALLS_PER_SECOND]
-		queryTimes = queryTimes[len(queryTimes)-MAX_API_CALLS_PER_SECOND:]
-
-		if elapsed<1000000000 {
-			time.Sleep(time.Duration(1000000000-elapsed) * time.Nanosecond)
-			queryTimes[len(queryTimes)-1] = time.Now().UnixNano()
-		}
-	}
-	
-	mutex.Unlock()
-}
-
 // New creates a new Google Drive driver, client must me an authenticated instance for google drive
 func New(client *http.Client, opts ...Option) (*GDriver, error) {
 	sharedInitOnce.Do(sharedInit)
 
 	driver := &GDriver{
-		Logger: log.Nothing(),
+		Logger:        log.Nothing(),
+		client:        client,
+		rateLimiter:   NewTokenBucket(DefaultTokenBucketConfig),
+		retryPolicy:   &DefaultRetryPolicy,
+		ExportFormats: DefaultExportFormats,
+		exportSizes:   cache.NewCacheWithConfig(cache.Config{MaxEntries: exportSizesCacheMaxEntries}),
+		exports:       cache.NewCacheWithConfig(cache.Config{MaxBytes: exportsCacheMaxBytes}),
 	}
 
 	var err error
@@ -118,6 +145,10 @@ func New(client *http.Client, opts ...Option) (*GDriver, error) {
 		return nil, fmt.Errorf("unable to retrieve Drive client: %w", err)
 	}
 
+	driver.srvWrapper = NewAPIWrapper(driver.srv, driver.Logger.With("component", "api"))
+	driver.srvWrapper.limiter = driver.rateLimiter
+	driver.srvWrapper.retryPolicy = driver.retryPolicy
+
 	if _, err = driver.SetRootDirectory(""); err != nil {
 		return nil, err
 	}
@@ -128,16 +159,58 @@ func New(client *http.Client, opts ...Option) (*GDriver, error) {
 		}
 	}
 
-	driver.srvWrapper = NewAPIWrapper(driver.srv, driver.Logger.With("component", "api"))
+	// The logger could have been set by an option
+	driver.srvWrapper.logger = driver.Logger.With("component", "api")
 
 	return driver, nil
 }
 
+// WithContext returns a view of the driver whose API calls and streams are bound to ctx. The view shares the
+// configuration of the driver as it was at this time, but changing its root directory won't affect the driver.
+func (d *GDriver) WithContext(ctx context.Context) *GDriver {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	view := *d
+	view.ctx = ctx
+
+	if d.srvWrapper != nil {
+		view.srvWrapper = d.srvWrapper.withContext(ctx)
+	}
+
+	return &view
+}
+
+// Context returns the context of the driver, it's context.Background() unless WithContext was used
+func (d *GDriver) Context() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+
+	return context.Background()
+}
+
+// rateLimit waits until the rate limiter allows a call of the given kind
+func (d *GDriver) rateLimit(kind CallKind) error {
+	return d.rateLimiter.Wait(d.Context(), kind)
+}
+
+// callAPI performs a rate limited API call, and retries it if it fails with a transient error
+func (d *GDriver) callAPI(kind CallKind, idempotent bool, call func() error) error {
+	return callAPI(d.Context(), d.rateLimiter, d.retryPolicy, kind, idempotent, call)
+}
+
 // Name provides the name of this filesystem
 func (d *GDriver) Name() string {
 	return "gdrive"
 }
 
+// CacheStats returns the counters of the cache of the path lookups
+func (d *GDriver) CacheStats() cache.Stats {
+	return d.srvWrapper.cache.Stats()
+}
+
 // AsAfero provides a cast to afero interface for easier testing
 func (d *GDriver) AsAfero() afero.Fs {
 	return d
@@ -152,7 +225,7 @@ func (d *GDriver) SetRootNode(id string) error {
 // use this if you want to do certain operations in a special directory
 // path should always be the absolute real path
 func (d *GDriver) SetRootDirectory(path string) (*FileInfo, error) {
-	rootNode, err := getRootNode(d.srv, d.rootNodeId)
+	rootNode, err := d.getRootNode()
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Drive root: %w", err)
 	}
@@ -183,15 +256,24 @@ func (d *GDriver) listDirectory(f *File, count int) ([]os.FileInfo, error) {
 		return nil, FileIsNotDirectoryError{Fi: f.FileInfo}
 	}
 
+	if f.FileInfo.isVirtual() {
+		return d.listVirtualRoot(f, count)
+	}
+
 	files := make([]os.FileInfo, 0)
 
+	// The duplicates can only be handled with the whole listing
+	if d.srvWrapper.UseCache || d.Duplicates != DuplicatesError {
+		return d.listCachedDirectory(f, count)
+	}
+
 	for count < 0 || len(files) < count {
 		pageSize := int64(count - len(files))
 		if pageSize > filesListPageSizeMax || pageSize <= 0 {
 			pageSize = filesListPageSizeMax
 		}
 
-		call := d.srv.Files.List().
+		call := inDrive(d.srv.Files.List(), f.FileInfo.file.DriveId).
 			Q(fmt.Sprintf("'%s' in parents and trashed = false", f.FileInfo.file.Id)).
 			Fields(append(listFields, "nextPageToken")...).
 			SupportsAllDrives(true).
@@ -203,8 +285,14 @@ func (d *GDriver) listDirectory(f *File, count int) ([]os.FileInfo, error) {
 			call = call.PageToken(f.dirListToken)
 		}
 
-		RateLimit();
-		descendants, err := call.Do()
+		var descendants *drive.FileList
+
+		err := d.callAPI(CallRead, true, func() error {
+			var err error
+			descendants, err = call.Context(d.Context()).Do()
+
+			return err
+		})
 		if err != nil {
 			return nil, &DriveAPICallError{Err: err}
 		}
@@ -214,10 +302,11 @@ func (d *GDriver) listDirectory(f *File, count int) ([]os.FileInfo, error) {
 		}
 
 		for i := 0; i < len(descendants.Files); i++ {
-			files = append(files, &FileInfo{
-				file:       descendants.Files[i],
-				parentPath: f.FileInfo.Path(),
-			})
+			if d.HideGoogleDocs && isGoogleDoc(descendants.Files[i]) {
+				continue
+			}
+
+			files = append(files, d.newFileInfo(descendants.Files[i], f.FileInfo.Path()))
 		}
 
 		f.dirListToken = descendants.NextPageToken
@@ -230,6 +319,32 @@ func (d *GDriver) listDirectory(f *File, count int) ([]os.FileInfo, error) {
 	return files, nil
 }
 
+// listCachedDirectory lists a directory from the cached snapshot of its folder
+func (d *GDriver) listCachedDirectory(f *File, count int) ([]os.FileInfo, error) {
+	if f.dirEntries == nil {
+		listing, err := d.srvWrapper.listFolder(f.FileInfo.file)
+		if err != nil {
+			return nil, &DriveAPICallError{Err: err}
+		}
+
+		f.dirEntries = d.folderEntries(listing.files, f.FileInfo.Path())
+	}
+
+	files := make([]os.FileInfo, 0)
+
+	for len(f.dirEntries) > 0 && (count <= 0 || len(files) < count) {
+		files = append(files, f.dirEntries[0])
+		f.dirEntries = f.dirEntries[1:]
+	}
+
+	// Like with the paged listing, the next call starts again once everything was listed
+	if len(f.dirEntries) == 0 {
+		f.dirEntries = nil
+	}
+
+	return files, nil
+}
+
 // Mkdir creates a directory in the filesystem, return an error if any
 // happens.
 func (d *GDriver) Mkdir(path string, perm os.FileMode) error {
@@ -247,19 +362,19 @@ func (d *GDriver) makeDirectoryByParts(pathParts []string) (*FileInfo, error) {
 	parentNode := d.rootNode
 
 	for i := 0; i < len(pathParts); i++ {
-		files, err := d.srvWrapper.getFileByFolderAndName(parentNode.file.Id, pathParts[i], listFields...)
+		file, suffix, err := d.findFile(parentNode.file, pathParts[i], listFields[0], false, path.Join(pathParts[:i+1]...))
 		if err != nil {
-			return nil, &DriveAPICallError{Err: err}
-		}
-
-		if files == nil {
-			return nil, &NoFileInformationError{Fi: parentNode, Path: path.Join(pathParts[:i+1]...)}
+			return nil, err
 		}
 
-		switch len(files.Files) {
-		case 0:
+		switch {
+		case file == nil:
 			{
 				// File not found => create directory
+				if parentNode.isVirtual() {
+					return nil, ErrForbiddenOnRoot
+				}
+
 				if !parentNode.IsDir() {
 					return nil, FileIsNotDirectoryError{
 						Fi:   parentNode,
@@ -272,7 +387,6 @@ func (d *GDriver) makeDirectoryByParts(pathParts []string) (*FileInfo, error) {
 					parentNode.file.Id,
 					pathParts[i],
 					mimeTypeFolder,
-					fileInfoFields...,
 				)
 				if err != nil {
 					return nil, &DriveAPICallError{Err: err}
@@ -283,17 +397,14 @@ func (d *GDriver) makeDirectoryByParts(pathParts []string) (*FileInfo, error) {
 					parentPath: path.Join(pathParts[:i]...),
 				}
 			}
-		case 1:
+		default:
 			{
 				parentNode = &FileInfo{
-					file:       files.Files[0],
+					file:       file,
 					parentPath: path.Join(pathParts[:i]...),
+					suffix:     suffix,
 				}
 			}
-		default:
-			{
-				return nil, &FileHasMultipleEntriesError{Path: path.Join(pathParts[:i+1]...)}
-			}
 		}
 	}
 
@@ -311,7 +422,7 @@ func (d *GDriver) DeleteDirectory(path string) error {
 		return FileIsNotDirectoryError{Fi: file}
 	}
 
-	if file == d.rootNode {
+	if d.isRoot(file) {
 		return ErrForbiddenOnRoot
 	}
 
@@ -333,7 +444,7 @@ func (d *GDriver) RemoveAll(path string) error {
 		return err
 	}
 
-	if file == d.rootNode {
+	if d.isRoot(file) {
 		return ErrForbiddenOnRoot
 	}
 
@@ -346,20 +457,53 @@ func (d *GDriver) Remove(path string) error {
 	return d.RemoveAll(path)
 }
 
+// downloadCall is a request downloading the content of a file, or of one of its revisions
+type downloadCall interface {
+	Header() http.Header
+	Download(opts ...googleapi.CallOption) (*http.Response, error)
+}
+
 func (d *GDriver) getFileReader(fi *FileInfo, offset int64) (io.ReadCloser, error) {
+	return d.getFileRangeReader(fi, offset, -1)
+}
+
+// getFileRangeReader opens a reader from the offset start to the offset end (inclusive), or the end of the file
+// if end is negative
+func (d *GDriver) getFileRangeReader(fi *FileInfo, start, end int64) (io.ReadCloser, error) {
 	if fi.IsDir() {
 		return nil, FileIsDirectoryError{Path: fi.Path()}
 	}
 
-	request := d.srv.Files.Get(fi.file.Id).SupportsAllDrives(true)
+	if fi.export != nil {
+		return d.getExportRangeReader(fi, start, end)
+	}
 
-	if offset > 0 {
-		request.Header().Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if isGoogleDoc(fi.file) {
+		return nil, ErrNotExportable
 	}
 
+	var request downloadCall = d.srv.Files.Get(fi.file.Id).SupportsAllDrives(true).Context(d.Context())
+
+	if fi.revision != "" {
+		request = d.srv.Revisions.Get(fi.file.Id, fi.revision).Context(d.Context())
+	}
+
+	switch {
+	case end >= 0:
+		request.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	case start > 0:
+		request.Header().Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	var response *http.Response
+
 	// The resulting stream will be closed by the reader of the file
-	// nolint:bodyclose
-	response, err := request.Download()
+	err := d.callAPI(CallRead, true, func() error {
+		var err error
+		response, err = request.Download() // nolint:bodyclose
+
+		return err
+	})
 	if err != nil {
 		return nil, &DriveAPICallError{Err: err}
 	}
@@ -367,6 +511,65 @@ func (d *GDriver) getFileReader(fi *FileInfo, offset int64) (io.ReadCloser, erro
 	return response.Body, nil
 }
 
+// readFileAt reads len(p) bytes of a file from an offset with a ranged download. Like io.ReaderAt, it only returns
+// fewer bytes with an error, which is io.EOF if the end of the file was reached.
+func (d *GDriver) readFileAt(fi *FileInfo, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// The size of the exports is only known once they're exported, and they're clipped to it
+	if fi.export == nil && off >= fi.Size() {
+		return 0, io.EOF
+	}
+
+	n := 0
+
+	for n < len(p) {
+		read, err := d.readRange(fi, p[n:], off+int64(n))
+		n += read
+
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF) && fi.export == nil && off+int64(n) < fi.Size() && read > 0:
+			// The download ended before the end of the file, the rest is requested again
+		case errors.Is(err, io.EOF) && fi.export == nil && off+int64(n) < fi.Size():
+			return n, &DriveStreamError{Err: io.ErrUnexpectedEOF}
+		case errors.Is(err, io.EOF):
+			return n, io.EOF
+		default:
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// readRange reads a range of a file with a single download, it returns io.EOF if the download ends before p is full
+func (d *GDriver) readRange(fi *FileInfo, p []byte, off int64) (int, error) {
+	reader, err := d.getFileRangeReader(fi, off, off+int64(len(p))-1)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() { _ = reader.Close() }()
+
+	n, err := io.ReadFull(reader, p)
+
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		return n, io.EOF
+	case err != nil:
+		return n, &DriveStreamError{Err: err}
+	}
+
+	return n, nil
+}
+
 func (d *GDriver) getFileWriter(fi *FileInfo) (io.WriteCloser, chan error, error) {
 	if fi == nil {
 		return nil, nil, errInternalNil
@@ -385,8 +588,24 @@ func (d *GDriver) getFileWriter(fi *FileInfo) (io.WriteCloser, chan error, error
 			)
 		}
 
-		RateLimit()
-		_, err := d.srv.Files.Update(fi.file.Id, nil).Fields(fileInfoFields...).SupportsAllDrives(true).Media(reader).Do()
+		err := d.rateLimit(CallWrite)
+		if err == nil {
+			var file *drive.File
+
+			file, err = d.srv.Files.Update(fi.file.Id, nil).
+				Fields(fileInfoFields...).
+				SupportsAllDrives(true).
+				Media(reader).
+				Context(d.Context()).
+				Do()
+
+			d.srvWrapper.fileUpdated(file, fi.file.Parents)
+		}
+
+		// If the upload was aborted (like when the context is canceled), the pending writes shall fail
+		if err != nil {
+			_ = reader.CloseWithError(err)
+		}
 
 		endErr <- err
 
@@ -424,7 +643,7 @@ func (d *GDriver) createFile(filePath string) (*FileInfo, error) {
 		existentFile = nil
 	}
 
-	if existentFile == d.rootNode {
+	if existentFile != nil && d.isRoot(existentFile) {
 		return nil, ErrForbiddenOnRoot
 	}
 
@@ -446,7 +665,11 @@ func (d *GDriver) createFile(filePath string) (*FileInfo, error) {
 		}
 	}
 
-	file, err := d.srvWrapper.createFile(parentNode.file.Id, pathParts[amountOfParts-1], mimeTypeFile, fileInfoFields...)
+	if parentNode.isVirtual() {
+		return nil, ErrForbiddenOnRoot
+	}
+
+	file, err := d.srvWrapper.createFile(parentNode.file.Id, pathParts[amountOfParts-1], mimeTypeFile)
 	if err != nil {
 		return nil, &DriveAPICallError{Err: err}
 	}
@@ -466,12 +689,19 @@ func (d *GDriver) Rename(oldPath, newPath string) error {
 		return ErrEmptyPath
 	}
 
-	file, err := d.getFile(oldPath, "files(id,parents)")
+	file, err := d.getFile(oldPath, "files(id,mimeType,parents)")
 	if err != nil {
 		return err
 	}
 
-	if file == d.rootNode {
+	targetName := pathParts[amountOfParts-1]
+
+	// Documents keep their name without the extension of their export format
+	if file.export != nil {
+		targetName, _ = trimExtension(targetName, file.export.Extension)
+	}
+
+	if d.isRoot(file) {
 		return ErrForbiddenOnRoot
 	}
 
@@ -491,19 +721,13 @@ func (d *GDriver) Rename(oldPath, newPath string) error {
 		}
 	}
 
-	RateLimit()
-	_, err = d.srv.Files.Update(file.file.Id, &drive.File{
-		Name: sanitizeName(pathParts[amountOfParts-1]),
-	}).
-		AddParents(parentNode.file.Id).
-		RemoveParents(path.Join(file.file.Parents...)).
-		Fields(fileInfoFields...).SupportsAllDrives(true).Do()
-
-	if err != nil {
-		return &DriveAPICallError{Err: err}
+	if parentNode.isVirtual() {
+		return ErrForbiddenOnRoot
 	}
 
-	return nil
+	_, err = d.srvWrapper.renameFile(file.file, parentNode.file, targetName)
+
+	return err
 }
 
 func (d *GDriver) trashPath(path string) error {
@@ -515,55 +739,28 @@ func (d *GDriver) trashPath(path string) error {
 	return d.srvWrapper.deleteFile(fi.file, true)
 }
 
-// ListTrash lists the contents of the trash
-// if you specify directories it will only list the trash contents of the specified directories
-func (d *GDriver) ListTrash(filePath string, _ int) ([]*FileInfo, error) {
-	file, err := d.getFile(filePath, "files(id,name)")
-	if err != nil {
-		return nil, err
-	}
-
-	// no directories specified
-	RateLimit()
-	files, err := d.srv.Files.List().Q("trashed = true").Fields(
-		googleapi.Field(fmt.Sprintf("files(%s,parents)", googleapi.CombineFields(fileInfoFields))),
-	).SupportsAllDrives(true).IncludeItemsFromAllDrives(true).Do()
-	if err != nil {
-		return nil, &DriveAPICallError{Err: err}
-	}
-
-	var list []*FileInfo
-
-	for i := 0; i < len(files.Files); i++ {
-		// determinate the parent of this File
-		inRoot, parentPath, err := isInRoot(d.srv, file.file.Id, files.Files[i], "")
-		if err != nil {
-			return nil, err
+func (d *GDriver) getRootNode() (*FileInfo, error) {
+	rootNodeID := d.rootNodeId
+	if rootNodeID == "" {
+		if d.SharedDrives {
+			return virtualRoot(), nil
 		}
 
-		if inRoot {
-			list = append(
-				list,
-				&FileInfo{
-					file:       files.Files[i],
-					parentPath: path.Join(file.Path(), parentPath),
-				},
-			)
-		}
+		rootNodeID = "root"
 	}
 
-	return list, nil
-}
+	var root *drive.File
 
-func getRootNode(srv *drive.Service, rootNodeId string) (*FileInfo, error) {
-	if rootNodeId=="" {
-		rootNodeId = "root"
-	}
-	root, err := srv.Files.Get(rootNodeId).
-		Fields(fileInfoFields...).
-		SupportsAllDrives(true).
-		Do()
+	err := d.callAPI(CallRead, true, func() error {
+		var err error
+		root, err = d.srv.Files.Get(rootNodeID).
+			Fields(fileInfoFields...).
+			SupportsAllDrives(true).
+			Context(d.Context()).
+			Do()
 
+		return err
+	})
 	if err != nil {
 		return nil, &DriveAPICallError{Err: err}
 	}
@@ -574,27 +771,6 @@ func getRootNode(srv *drive.Service, rootNodeId string) (*FileInfo, error) {
 	}, nil
 }
 
-// isInRoot checks if a File is a descendant of root, if so it will return the parent path of the File
-func isInRoot(srv *drive.Service, rootID string, file *drive.File, basePath string) (bool, string, error) {
-	for _, parentID := range file.Parents {
-		if parentID == rootID {
-			return true, basePath, nil
-		}
-
-		RateLimit()
-		parent, err := srv.Files.Get(parentID).Fields("id,name,parents").SupportsAllDrives(true).Do()
-		if err != nil {
-			return false, "", &DriveAPICallError{Err: err}
-		}
-
-		if inRoot, parentPath, err := isInRoot(srv, rootID, parent, path.Join(parent.Name, basePath)); err != nil || inRoot {
-			return inRoot, parentPath, err
-		}
-	}
-
-	return false, "", nil
-}
-
 func (d *GDriver) getFile(path string, fields ...googleapi.Field) (*FileInfo, error) {
 	return d.getFileOnRootNode(d.rootNode, path, fields...)
 }
@@ -613,13 +789,25 @@ func (d *GDriver) getFileByParts(rootNode *FileInfo, pathParts []string, fields
 		return rootNode, nil
 	}
 
-	lastID := rootNode.file.Id
+	lastFile := rootNode.file
 	lastPart := amountOfParts - 1
-	var lastFile *drive.File
 
 	requestedFields := googleapi.Field(googleapi.CombineFields(fields))
 
-	for i := 0; i < amountOfParts; i++ {
+	// The resolution starts from the deepest directory of the path that was already resolved
+	generation := d.srvWrapper.generation()
+	resolved, start := d.srvWrapper.getResolvedPath(rootNode.file.Id, pathParts[:lastPart])
+
+	var ids []string
+
+	lastSuffix := ""
+
+	if resolved != nil {
+		lastFile = resolved.folder
+		ids = resolved.ids
+	}
+
+	for i := start; i < amountOfParts; i++ {
 		fileName := pathParts[i]
 
 		var queryFields googleapi.Field
@@ -629,27 +817,33 @@ func (d *GDriver) getFileByParts(rootNode *FileInfo, pathParts []string, fields
 			queryFields = ""
 		}
 
-		files, err := d.srvWrapper.getFileByFolderAndName(lastID, fileName, queryFields)
+		// Documents are listed with the extension of their export format
+		file, suffix, err := d.findFile(lastFile, fileName, queryFields, i == lastPart, path.Join(pathParts[:i+1]...))
 		if err != nil {
-			return nil, &DriveAPICallError{Err: err}
+			return nil, err
 		}
 
-		if files == nil || len(files.Files) == 0 {
+		if file == nil {
 			return nil, &FileNotExistError{Path: path.Join(pathParts[:i+1]...)}
 		}
 
-		if len(files.Files) > 1 {
-			return nil, &FileHasMultipleEntriesError{Path: path.Join(pathParts[:i+1]...)}
-		}
+		lastFile, lastSuffix = file, suffix
 
-		lastFile = files.Files[0]
-		lastID = lastFile.Id
+		if i < lastPart && lastFile.MimeType == mimeTypeFolder {
+			ids = append(ids[:len(ids):len(ids)], lastFile.Id)
+			d.srvWrapper.setResolvedPath(
+				rootNode.file.Id,
+				pathParts[:i+1],
+				&resolvedPath{folder: lastFile, ids: ids},
+				generation,
+			)
+		}
 	}
 
-	return &FileInfo{
-		file:       lastFile,
-		parentPath: path.Join(pathParts[:amountOfParts-1]...),
-	}, nil
+	fi := d.newFileInfo(lastFile, path.Join(pathParts[:amountOfParts-1]...))
+	fi.suffix = lastSuffix
+
+	return fi, nil
 }
 
 // Open a File for reading.
@@ -663,8 +857,14 @@ func (d *GDriver) OpenFile(path string, flag int, _ os.FileMode) (afero.File, er
 		return nil, ErrEmptyPath
 	}
 
-	if flag&os.O_RDWR != 0 {
-		return nil, ErrReadAndWriteNotSupported
+	spooled := flag&os.O_RDWR != 0 || flag&os.O_APPEND != 0 && flag&os.O_WRONLY != 0
+
+	if spooled && !d.SpoolFiles {
+		if flag&os.O_RDWR != 0 {
+			return nil, ErrReadAndWriteNotSupported
+		}
+
+		spooled = false
 	}
 
 	// determinate existent status
@@ -683,6 +883,11 @@ func (d *GDriver) OpenFile(path string, flag int, _ os.FileMode) (afero.File, er
 					FileInfo: file,
 				}, nil
 			}
+
+			// Documents can only be exported
+			if isGoogleDoc(file.file) && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+				return nil, ErrNotSupported
+			}
 		}
 	case IsNotExist(err):
 		{
@@ -696,7 +901,7 @@ func (d *GDriver) OpenFile(path string, flag int, _ os.FileMode) (afero.File, er
 
 	// We should try to create the file if we have the right to do so
 	if !fileExists {
-		if flag&os.O_CREATE != 0 && flag&os.O_WRONLY != 0 {
+		if flag&os.O_CREATE != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
 			file, err = d.createFile(path)
 			if err != nil {
 				return nil, err
@@ -708,6 +913,10 @@ func (d *GDriver) OpenFile(path string, flag int, _ os.FileMode) (afero.File, er
 		}
 	}
 
+	if spooled {
+		return d.openFileSpooled(file, path, flag)
+	}
+
 	// If we're in write mode
 	if flag&os.O_WRONLY != 0 {
 		if !fileExists {
@@ -721,7 +930,7 @@ func (d *GDriver) OpenFile(path string, flag int, _ os.FileMode) (afero.File, er
 }
 
 func (d *GDriver) openFileRead(file *FileInfo) (afero.File, error) {
-	reader, errReader := d.getFileReader(file, 0)
+	reader, errReader := d.openReader(file, 0)
 
 	if errReader != nil {
 		return nil, errReader
@@ -754,6 +963,10 @@ func (d *GDriver) wrapWriteCloser(dst io.WriteCloser) (io.WriteCloser, error) {
 }
 
 func (d *GDriver) openFileWrite(file *FileInfo, path string) (afero.File, error) {
+	if d.UploadChunkSize > 0 {
+		return d.openFileResumable(file, path)
+	}
+
 	writer, endErr, err := d.getFileWriter(file)
 	if err != nil {
 		return nil, err
@@ -772,6 +985,171 @@ func (d *GDriver) openFileWrite(file *FileInfo, path string) (afero.File, error)
 	}, nil
 }
 
+// openFileSpooled opens a file on a local copy of its content, this allows random reads & writes. The content is
+// uploaded back when the file is synced or closed.
+func (d *GDriver) openFileSpooled(file *FileInfo, path string, flag int) (afero.File, error) {
+	spool := iohelper.NewSpoolFile(d.SpoolDirectory, d.SpoolMemoryLimit)
+
+	truncate := flag&os.O_TRUNC != 0
+
+	if !truncate && file.Size() > 0 {
+		reader, err := d.getFileReader(file, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = spool.ReadFrom(reader)
+		_ = reader.Close()
+
+		if err != nil {
+			_ = spool.Close()
+			return nil, &DriveStreamError{Err: err}
+		}
+	}
+
+	return &File{
+		driver:      d,
+		Path:        path,
+		FileInfo:    file,
+		spool:       spool,
+		spoolDirty:  truncate && file.Size() > 0,
+		spoolAppend: flag&os.O_APPEND != 0,
+		spoolRead:   flag&os.O_RDWR != 0,
+	}, nil
+}
+
+// uploadSpool uploads the local copy of a file
+func (d *GDriver) uploadSpool(f *File) error {
+	if d.LogReaderAndWriters {
+		d.Logger.Info("Uploading the spooled file",
+			"fileId", f.file.Id,
+			"fileName", f.file.Name,
+			"size", f.spool.Size(),
+		)
+	}
+
+	var file *drive.File
+
+	// The local copy can be read again, so the upload can be retried
+	err := d.callAPI(CallWrite, true, func() error {
+		var err error
+		file, err = d.srv.Files.Update(f.file.Id, nil).
+			Fields(fileInfoFields...).
+			SupportsAllDrives(true).
+			Media(f.spool.Reader()).
+			Context(d.Context()).
+			Do()
+
+		return err
+	})
+	if err != nil {
+		return &DriveAPICallError{Err: err}
+	}
+
+	d.srvWrapper.fileUpdated(file, f.file.Parents)
+	f.file = file
+
+	return nil
+}
+
+// truncateFile changes the size of a file. As Google Drive doesn't support it, the file is rewritten: its first
+// bytes are streamed from a ranged download into an upload, and zeros are added if the file grows.
+func (d *GDriver) truncateFile(fi *FileInfo, size int64) error {
+	if fi.IsDir() {
+		return FileIsDirectoryError{Path: fi.Path()}
+	}
+
+	if size < 0 {
+		return ErrInvalidSize
+	}
+
+	// Documents can only be exported
+	if isGoogleDoc(fi.file) {
+		return ErrNotSupported
+	}
+
+	var file *drive.File
+
+	// Each attempt streams the content again, so the upload can be retried
+	err := d.callAPI(CallWrite, true, func() error {
+		content, err := d.truncatedContent(fi, size)
+		if err != nil {
+			return err
+		}
+
+		defer func() { _ = content.Close() }()
+
+		file, err = d.srv.Files.Update(fi.file.Id, nil).
+			Fields(fileInfoFields...).
+			SupportsAllDrives(true).
+			Media(content).
+			Context(d.Context()).
+			Do()
+
+		return err
+	})
+
+	if err != nil {
+		// The errors of the download are already wrapped
+		var apiErr *DriveAPICallError
+		if errors.As(err, &apiErr) {
+			return err
+		}
+
+		return &DriveAPICallError{Err: err}
+	}
+
+	d.srvWrapper.fileUpdated(file, fi.file.Parents)
+	fi.file = file
+
+	return nil
+}
+
+// truncatedContent returns the content of a file truncated (or extended with zeros) to size
+func (d *GDriver) truncatedContent(fi *FileInfo, size int64) (io.ReadCloser, error) {
+	content := ioutil.NopCloser(bytes.NewReader(nil))
+
+	if kept := min64(size, fi.Size()); kept > 0 {
+		reader, err := d.getFileRangeReader(fi, 0, kept-1)
+		if err != nil {
+			return nil, err
+		}
+
+		content = &readCloser{Reader: io.LimitReader(reader, kept), Closer: reader}
+	}
+
+	if grown := size - fi.Size(); grown > 0 {
+		content = &readCloser{Reader: io.MultiReader(content, io.LimitReader(zeroReader{}, grown)), Closer: content}
+	}
+
+	return content, nil
+}
+
+// readCloser combines a reader with the closer of its source
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// zeroReader is an endless source of zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+
+	return len(p), nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
 // Create creates a file in the filesystem, returning the file and an
 // error, if any happens.
 func (d *GDriver) Create(name string) (afero.File, error) {
@@ -787,24 +1165,71 @@ func (d *GDriver) Create(name string) (afero.File, error) {
 	return file, nil
 }
 
-// Chmod changes the mode of the named file to mode.
+// Chmod changes the mode of the named file to mode. With the ModeSharing option, the read bit of the others also
+// shares the file with anyone having the link, or unshares it.
 func (d *GDriver) Chmod(path string, mode os.FileMode) error {
 	fi, err := d.getFile(path)
 	if err != nil {
 		return err
 	}
 
-	RateLimit()
-	_, err = d.srv.Files.Update(fi.file.Id, &drive.File{
-		Properties: map[string]string{
-			"ftp_file_mode": fmt.Sprintf("%d", mode),
-		},
-	}).SupportsAllDrives(true).Do()
+	if fi.isVirtual() {
+		return ErrForbiddenOnRoot
+	}
+
+	if d.ModeSharing {
+		if err := d.shareWithAnyone(fi, mode&0004 != 0); err != nil {
+			return err
+		}
+	}
+
+	var file *drive.File
 
+	err = d.callAPI(CallWrite, true, func() error {
+		var err error
+		file, err = d.srv.Files.Update(fi.file.Id, &drive.File{
+			Properties: map[string]string{
+				modeProperty: fmt.Sprintf("%d", mode),
+			},
+		}).Fields(fileInfoFields...).SupportsAllDrives(true).Context(d.Context()).Do()
+
+		return err
+	})
 	if err != nil {
 		return &DriveAPICallError{Err: err}
 	}
 
+	d.srvWrapper.fileUpdated(file, fi.file.Parents)
+
+	return nil
+}
+
+// shareWithAnyone shares a file with anyone having the link as a reader, or removes the permissions given to anyone
+func (d *GDriver) shareWithAnyone(fi *FileInfo, shared bool) error {
+	if shared && fi.sharedWithAnyone() {
+		return nil
+	}
+
+	if shared {
+		_, err := d.share(fi, Permission{Type: PermissionAnyone, Role: RoleReader})
+		return err
+	}
+
+	permissions, err := d.listPermissions(fi)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range permissions {
+		if p.Type != PermissionAnyone {
+			continue
+		}
+
+		if err := d.unshare(fi, p.ID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -815,17 +1240,28 @@ func (d *GDriver) Chtimes(path string, atime time.Time, mTime time.Time) error {
 		return err
 	}
 
-	RateLimit()
-	_, err = d.srv.Files.Update(fi.file.Id, &drive.File{
-		ViewedByMeTime: atime.Format(time.RFC3339),
-		ModifiedTime:   mTime.Format(time.RFC3339),
-		// ModifiedByMeTime: mTime.Format(time.RFC3339),
-	}).SupportsAllDrives(true).Do()
+	if fi.isVirtual() {
+		return ErrForbiddenOnRoot
+	}
 
+	var file *drive.File
+
+	err = d.callAPI(CallWrite, true, func() error {
+		var err error
+		file, err = d.srv.Files.Update(fi.file.Id, &drive.File{
+			ViewedByMeTime: atime.Format(time.RFC3339),
+			ModifiedTime:   mTime.Format(time.RFC3339),
+			// ModifiedByMeTime: mTime.Format(time.RFC3339),
+		}).Fields(fileInfoFields...).SupportsAllDrives(true).Context(d.Context()).Do()
+
+		return err
+	})
 	if err != nil {
 		return &DriveAPICallError{Err: err}
 	}
 
+	d.srvWrapper.fileUpdated(file, fi.file.Parents)
+
 	return nil
 }
 
@@ -833,3 +1269,132 @@ func (d *GDriver) Chtimes(path string, atime time.Time, mTime time.Time) error {
 func (d *GDriver) Chown(string, int, int) error {
 	return ErrNotSupported
 }
+
+// fileChecksums contains the checksums computed by Google Drive
+type fileChecksums struct {
+	Md5Checksum    string `json:"md5Checksum"`
+	Sha1Checksum   string `json:"sha1Checksum"`
+	Sha256Checksum string `json:"sha256Checksum"`
+}
+
+func (c *fileChecksums) get(method HashMethod) string {
+	switch method {
+	case HashMethodMD5:
+		return c.Md5Checksum
+	case HashMethodSHA1:
+		return c.Sha1Checksum
+	case HashMethodSHA256:
+		return c.Sha256Checksum
+	default:
+		return ""
+	}
+}
+
+func newHash(method HashMethod) (hash.Hash, error) {
+	switch method {
+	case HashMethodMD5:
+		return md5.New(), nil // nolint: gosec
+	case HashMethodSHA1:
+		return sha1.New(), nil // nolint: gosec
+	case HashMethodSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, ErrUnknownHashMethod
+	}
+}
+
+// GetFileHash returns the hexadecimal hash of a file. The checksum computed by Google Drive is used when available,
+// otherwise the file is downloaded and hashed locally.
+func (d *GDriver) GetFileHash(path string, method HashMethod) (string, error) {
+	if _, err := newHash(method); err != nil {
+		return "", err
+	}
+
+	fi, err := d.getFile(path, listFields...)
+	if err != nil {
+		return "", err
+	}
+
+	if fi.IsDir() {
+		return "", FileIsDirectoryError{Path: fi.Path()}
+	}
+
+	// The MD5 checksum is part of the metadata, only the other ones need another call
+	if method == HashMethodMD5 {
+		if fi.file.Md5Checksum != "" {
+			return fi.file.Md5Checksum, nil
+		}
+
+		return d.hashFileContent(fi, method)
+	}
+
+	checksums, err := d.getFileChecksums(fi)
+	if err != nil {
+		return "", err
+	}
+
+	if sum := checksums.get(method); sum != "" {
+		return sum, nil
+	}
+
+	return d.hashFileContent(fi, method)
+}
+
+// getFileChecksums fetches the checksums of a file. The sha1Checksum and sha256Checksum fields aren't exposed by
+// drive.File so we have to perform the metadata call ourselves.
+func (d *GDriver) getFileChecksums(fi *FileInfo) (*fileChecksums, error) {
+	query := url.Values{}
+	query.Set("fields", "md5Checksum,sha1Checksum,sha256Checksum")
+	query.Set("supportsAllDrives", "true")
+	query.Set("alt", "json")
+
+	urls := googleapi.ResolveRelative(d.srv.BasePath, "files/"+url.PathEscape(fi.file.Id)) + "?" + query.Encode()
+
+	request, err := http.NewRequest(http.MethodGet, urls, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := &fileChecksums{}
+
+	err = d.callAPI(CallRead, true, func() error {
+		response, err := d.client.Do(request.WithContext(d.Context()))
+		if err != nil {
+			return err
+		}
+
+		defer googleapi.CloseBody(response)
+
+		if err := googleapi.CheckResponse(response); err != nil {
+			return err
+		}
+
+		return json.NewDecoder(response.Body).Decode(checksums)
+	})
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	return checksums, nil
+}
+
+// hashFileContent hashes a file by streaming its content
+func (d *GDriver) hashFileContent(fi *FileInfo, method HashMethod) (string, error) {
+	h, err := newHash(method)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := d.getFileReader(fi, 0)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() { _ = reader.Close() }()
+
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", &DriveStreamError{Err: err}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -4,9 +4,14 @@ package gdrive
 import (
 	"bytes"
 	"context"
+	"crypto/md5" // nolint: gosec
 	"crypto/rand"
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -16,15 +21,20 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	gklog "github.com/go-kit/kit/log"
 	"github.com/hjson/hjson-go"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
+	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 
+	"github.com/jonny5532/afero-gdrive/cache"
+	"github.com/jonny5532/afero-gdrive/drivetest"
 	"github.com/jonny5532/afero-gdrive/log/gokit"
 	"github.com/jonny5532/afero-gdrive/oauthhelper"
 )
@@ -61,13 +71,16 @@ func loadEnvFromFile(t *testing.T) {
 	}
 }
 
-func setup(t *testing.T) *GDriver {
-	initOnce.Do(varInit)
+// newClient creates an HTTP client for the tests. When no GOOGLE_TOKEN is provided, tests run against an in-process
+// fake of Google Drive.
+func newClient(t *testing.T) *http.Client {
+	envToken := os.Getenv("GOOGLE_TOKEN")
+	if envToken == "" {
+		server := drivetest.NewServer()
+		t.Cleanup(server.Close)
 
-	// All of our tests can run in parallel
-	t.Parallel()
-
-	loadEnvFromFile(t)
+		return server.Client()
+	}
 
 	helper := oauthhelper.Auth{
 		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
@@ -76,29 +89,66 @@ func setup(t *testing.T) *GDriver {
 			return "", ErrNotSupported
 		},
 	}
-	var client *http.Client
-	var driver *GDriver
-	var err error
 
-	{
-		envToken := os.Getenv("GOOGLE_TOKEN")
-		if envToken != "" {
-			var token []byte
-			token, err = base64.StdEncoding.DecodeString(envToken)
-			require.NoError(t, err)
+	token, err := base64.StdEncoding.DecodeString(envToken)
+	require.NoError(t, err)
 
-			helper.Token = new(oauth2.Token)
-			require.NoError(t, json.Unmarshal(token, helper.Token))
-		}
+	helper.Token = new(oauth2.Token)
+	require.NoError(t, json.Unmarshal(token, helper.Token))
+
+	client, err := helper.NewHTTPClient(context.Background())
+	require.NoError(t, err)
+
+	return client
+}
+
+func setup(t *testing.T, opts ...Option) *GDriver {
+	initOnce.Do(varInit)
+
+	// All of our tests can run in parallel
+	t.Parallel()
+
+	loadEnvFromFile(t)
+
+	return setupDriver(t, newClient(t), opts...)
+}
+
+// setupFake is like setup, but always works on the in-process fake of Google Drive, for the tests that control it.
+// As it has no quotas, the rate limiting is disabled.
+func setupFake(t *testing.T, opts ...Option) (*GDriver, *drivetest.Server) {
+	initOnce.Do(varInit)
+
+	t.Parallel()
+
+	server := drivetest.NewServer()
+	t.Cleanup(server.Close)
+
+	return setupDriver(t, server.Client(), append([]Option{RateLimiting(nil)}, opts...)...), server
+}
+
+// reopen creates another driver working in the root directory of a driver of setupFake, like another client or after
+// a restart
+func reopen(t *testing.T, server *drivetest.Server, driver *GDriver, opts ...Option) *GDriver {
+	root := RootNode(driver.rootNode.file.Id)
+	if driver.rootNode.isVirtual() {
+		root = SharedDrives()
 	}
 
-	client, err = helper.NewHTTPClient(context.Background())
+	other, err := New(server.Client(), append([]Option{RateLimiting(nil), Logger(driver.Logger), root}, opts...)...)
 	require.NoError(t, err)
 
-	driver, err = New(client)
+	return other
+}
+
+// setupDriver creates the driver of a test, working in a directory of its own. The drives of the virtual root can't
+// have one, the driver works directly on them.
+func setupDriver(t *testing.T, client *http.Client, opts ...Option) *GDriver {
+	driver, err := New(client, append([]Option{Logger(gokit.NewGKLoggerStdout())}, opts...)...)
 	require.NoError(t, err)
 
-	driver.Logger = gokit.NewGKLoggerStdout()
+	if driver.rootNode.isVirtual() {
+		return driver
+	}
 
 	fullPath := sanitizeName(fmt.Sprintf("GDriveTest-%s-%s", t.Name(), prefix))
 
@@ -376,6 +426,51 @@ func TestGetFile(t *testing.T) {
 	require.True(t, fileInfo.IsDir())
 }
 
+func TestGetFileHash(t *testing.T) {
+	driver := setup(t)
+
+	mustWriteFile(t, driver, "Folder1/File1")
+
+	content := []byte("Hello World")
+	md5Sum := md5.Sum(content)   // nolint: gosec
+	sha1Sum := sha1.Sum(content) // nolint: gosec
+	sha256Sum := sha256.Sum256(content)
+
+	expected := map[HashMethod]string{
+		HashMethodMD5:    hex.EncodeToString(md5Sum[:]),
+		HashMethodSHA1:   hex.EncodeToString(sha1Sum[:]),
+		HashMethodSHA256: hex.EncodeToString(sha256Sum[:]),
+	}
+
+	for method, sum := range expected {
+		hash, err := driver.GetFileHash("Folder1/File1", method)
+		require.NoError(t, err)
+		require.Equal(t, sum, hash)
+	}
+
+	t.Run("local hashing", func(t *testing.T) {
+		fi, err := driver.getFile("Folder1/File1", listFields...)
+		require.NoError(t, err)
+
+		for method, sum := range expected {
+			hash, err := driver.hashFileContent(fi, method)
+			require.NoError(t, err)
+			require.Equal(t, sum, hash)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := driver.GetFileHash("Folder1", HashMethodMD5)
+		require.EqualError(t, err, FileIsDirectoryError{Path: "Folder1"}.Error())
+
+		_, err = driver.GetFileHash("Folder1/File2", HashMethodMD5)
+		require.True(t, IsNotExist(err))
+
+		_, err = driver.GetFileHash("Folder1/File1", HashMethod(42))
+		require.Equal(t, ErrUnknownHashMethod, err)
+	})
+}
+
 func TestDelete(t *testing.T) {
 	t.Run("delete file", func(t *testing.T) {
 		driver := setup(t).AsAfero()
@@ -684,6 +779,71 @@ func TestListTrash(t *testing.T) {
 	})
 }
 
+func TestLogger(t *testing.T) {
+	logger := gokit.NewGKLogger(gklog.NewLogfmtLogger(ioutil.Discard))
+	driver, _ := setupFake(t, Logger(logger))
+	require.Equal(t, logger, driver.Logger)
+
+	// The API calls are logged with it too
+	require.Equal(t, logger.With("component", "api"), driver.srvWrapper.logger)
+}
+
+func TestWithContext(t *testing.T) {
+	driver := setup(t)
+
+	mustWriteFile(t, driver, "File1")
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		view := driver.WithContext(ctx)
+		require.Equal(t, ctx, view.Context())
+
+		// The lookups would otherwise be answered by the cached listings
+		driver.srvWrapper.cache.CleanupEverything()
+
+		_, err := view.Stat("Folder1/File1")
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = view.OpenFile("File2", os.O_WRONLY|os.O_CREATE, os.FileMode(0))
+		require.True(t, errors.Is(err, context.Canceled))
+
+		// The driver itself isn't affected
+		require.Equal(t, context.Background(), driver.Context())
+		require.NoError(t, getError(driver.Stat("File1")))
+	})
+
+	t.Run("canceled during write", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		f, err := driver.WithContext(ctx).OpenFile("File1", os.O_WRONLY, os.FileMode(0))
+		require.NoError(t, err)
+
+		_, err = f.WriteString("Hello")
+		require.NoError(t, err)
+
+		cancel()
+
+		err = f.Close()
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		f, err := driver.WithContext(ctx).Open("File1")
+		require.NoError(t, err)
+
+		data, err := ioutil.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "Hello World", string(data))
+		require.NoError(t, f.Close())
+	})
+}
+
 func TestIsInRoot(t *testing.T) {
 	t.Run("in folder", func(t *testing.T) {
 		driver := setup(t)
@@ -696,9 +856,10 @@ func TestIsInRoot(t *testing.T) {
 		)
 		require.NoError(t, err)
 
-		inRoot, parentPath, err := isInRoot(driver.srv, driver.rootNode.file.Id, fi.file, "")
+		parentPath, inRoot, live, err := driver.newTrashResolver(driver.rootNode.file.Id).parentPath(fi.file)
 		require.NoError(t, err)
 		require.True(t, inRoot)
+		require.True(t, live)
 		require.Equal(t, "Folder1", parentPath)
 	})
 
@@ -719,7 +880,16 @@ func TestAferoSpecifics(t *testing.T) {
 	driver := setup(t).AsAfero()
 	t.Run("Chmod", func(t *testing.T) {
 		mustWriteFileContent(t, driver, "Chmod", "Chmod test")
+
+		fi, err := driver.Stat("Chmod")
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0644), fi.Mode())
+
 		require.NoError(t, driver.Chmod("Chmod", os.FileMode(755)))
+
+		fi, err = driver.Stat("Chmod")
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(755).Perm(), fi.Mode())
 	})
 	t.Run("Chtimes", func(t *testing.T) {
 		mustWriteFileContent(t, driver, "Chtimes", "Chtimes test")
@@ -793,6 +963,58 @@ func TestOpen(t *testing.T) {
 				require.EqualValues(t, buf[:], data)
 			})
 		})
+		t.Run("ReadAt", func(t *testing.T) {
+			driver := setup(t)
+
+			var buf [4096*3 + 15]byte
+			_, err := rand.Read(buf[:])
+			require.NoError(t, err)
+			require.NoError(t, writeFile(driver, "Folder1/File1", bytes.NewBuffer(buf[:])))
+
+			f, err := driver.Open("Folder1/File1")
+			require.NoError(t, err)
+			defer func() { require.NoError(t, f.Close()) }()
+
+			start := make([]byte, 10)
+			_, err = io.ReadFull(f, start)
+			require.NoError(t, err)
+
+			// Concurrent reads of the file, a chunk each
+			var wg sync.WaitGroup
+			chunks := make([][]byte, 4)
+			errs := make([]error, len(chunks))
+
+			for i := range chunks {
+				wg.Add(1)
+
+				go func(i int) {
+					defer wg.Done()
+					chunks[i] = make([]byte, 4096)
+					_, errs[i] = f.ReadAt(chunks[i], int64(i*4096))
+				}(i)
+			}
+
+			wg.Wait()
+
+			for i := range chunks {
+				if i < len(chunks)-1 {
+					require.NoError(t, errs[i])
+					require.Equal(t, buf[i*4096:(i+1)*4096], chunks[i])
+				} else {
+					// The last one reaches the end of the file
+					require.Equal(t, io.EOF, errs[i])
+					require.Equal(t, buf[i*4096:], chunks[i][:15])
+				}
+			}
+
+			_, err = f.ReadAt(make([]byte, 1), int64(len(buf)))
+			require.Equal(t, io.EOF, err)
+
+			// The sequential reads continue where they were
+			data, err := ioutil.ReadAll(f)
+			require.NoError(t, err)
+			require.Equal(t, buf[10:], data)
+		})
 		t.Run("non-existing File", func(t *testing.T) {
 			driver := setup(t).AsAfero()
 
@@ -854,6 +1076,95 @@ func TestOpen(t *testing.T) {
 			require.Equal(t, "Hello Universe", string(received))
 		})
 	})
+
+	t.Run("read-write", func(t *testing.T) {
+		t.Run("not enabled", func(t *testing.T) {
+			driver := setup(t).AsAfero()
+
+			mustWriteFile(t, driver, "Folder1/File1")
+
+			f, err := driver.OpenFile("Folder1/File1", os.O_RDWR, os.FileMode(0))
+			require.Equal(t, ErrReadAndWriteNotSupported, err)
+			require.Nil(t, f)
+		})
+		t.Run("existing File", func(t *testing.T) {
+			driver := setup(t)
+			require.NoError(t, Spooling("", 4)(driver))
+
+			mustWriteFile(t, driver, "Folder1/File1")
+
+			f, err := driver.OpenFile("Folder1/File1", os.O_RDWR, os.FileMode(0))
+			require.NoError(t, err)
+
+			data := make([]byte, 5)
+			_, err = io.ReadFull(f, data)
+			require.NoError(t, err)
+			require.Equal(t, "Hello", string(data))
+
+			_, err = f.Seek(-5, io.SeekEnd)
+			require.NoError(t, err)
+			_, err = io.WriteString(f, "Earth!")
+			require.NoError(t, err)
+
+			// Only the open file reports the size of its local copy until it's synced
+			fi, err := f.Stat()
+			require.NoError(t, err)
+			require.EqualValues(t, 12, fi.Size())
+			fi, err = driver.Stat("Folder1/File1")
+			require.NoError(t, err)
+			require.EqualValues(t, 11, fi.Size())
+
+			require.NoError(t, f.Truncate(11))
+			require.NoError(t, f.Sync())
+
+			fi, err = f.Stat()
+			require.NoError(t, err)
+			require.EqualValues(t, 11, fi.Size())
+
+			_, err = f.WriteAt([]byte("J"), 0)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			// Compare File contents
+			r, err := driver.Open("Folder1/File1")
+			require.NoError(t, err)
+			received, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, "Jello Earth", string(received))
+		})
+		t.Run("non-existing File with create", func(t *testing.T) {
+			driver := setup(t)
+			require.NoError(t, Spooling("", 1024)(driver))
+
+			f, err := driver.OpenFile("Folder1/File1", os.O_RDWR|os.O_CREATE, os.FileMode(0))
+			require.NoError(t, err)
+			_, err = io.WriteString(f, "Hello Universe")
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			mustReadFileContent(t, driver, "Folder1/File1", "Hello Universe")
+		})
+		t.Run("append", func(t *testing.T) {
+			driver := setup(t)
+			require.NoError(t, Spooling("", 1024)(driver))
+
+			mustWriteFile(t, driver, "Folder1/File1")
+
+			f, err := driver.OpenFile("Folder1/File1", os.O_WRONLY|os.O_APPEND, os.FileMode(0))
+			require.NoError(t, err)
+
+			_, err = f.Seek(0, io.SeekStart)
+			require.NoError(t, err)
+			_, err = io.WriteString(f, " and Universe")
+			require.NoError(t, err)
+
+			_, err = f.Read(make([]byte, 1))
+			require.Equal(t, ErrWriteOnly, err)
+			require.NoError(t, f.Close())
+
+			mustReadFileContent(t, driver, "Folder1/File1", "Hello World and Universe")
+		})
+	})
 }
 
 func TestErrNotSupported(t *testing.T) {
@@ -863,12 +1174,285 @@ func TestErrNotSupported(t *testing.T) {
 		mustWriteFile(t, driver, "Chown")
 		require.EqualError(t, driver.Chown("Chown", 2000, 2000), ErrNotSupported.Error())
 	})
+}
+
+func TestTruncate(t *testing.T) {
+	driver := setup(t)
+
+	t.Run("empty", func(t *testing.T) {
+		mustWriteFile(t, driver, "File1")
+
+		f, err := driver.Open("File1")
+		require.NoError(t, err)
+		require.NoError(t, f.Truncate(0))
+
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		require.EqualValues(t, 0, fi.Size())
+
+		data, err := ioutil.ReadAll(f)
+		require.NoError(t, err)
+		require.Empty(t, data)
+		require.NoError(t, f.Close())
+
+		mustReadFileContent(t, driver, "File1", "")
+	})
+
+	t.Run("shrink", func(t *testing.T) {
+		mustWriteFile(t, driver, "File2")
+
+		f, err := driver.Open("File2")
+		require.NoError(t, err)
+
+		data := make([]byte, 2)
+		_, err = io.ReadFull(f, data)
+		require.NoError(t, err)
+
+		require.NoError(t, f.Truncate(5))
+
+		data, err = ioutil.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "llo", string(data))
+		require.NoError(t, f.Close())
+
+		mustReadFileContent(t, driver, "File2", "Hello")
+	})
+
+	t.Run("grow", func(t *testing.T) {
+		mustWriteFile(t, driver, "File3")
+
+		f, err := driver.Open("File3")
+		require.NoError(t, err)
+		require.NoError(t, f.Truncate(13))
+		require.NoError(t, f.Close())
+
+		mustReadFileContent(t, driver, "File3", "Hello World\x00\x00")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mustWriteFile(t, driver, "File4")
 
-	t.Run("Truncate", func(t *testing.T) {
-		mustWriteFile(t, driver, "Truncate")
-		f, err := driver.Open("Truncate")
+		f, err := driver.Open("File4")
+		require.NoError(t, err)
+		require.Equal(t, ErrInvalidSize, f.Truncate(-1))
+		require.NoError(t, f.Close())
+
+		f, err = driver.OpenFile("File4", os.O_WRONLY, os.FileMode(0))
+		require.NoError(t, err)
+		require.NoError(t, f.Truncate(0))
+		_, err = f.WriteString("Hello")
 		require.NoError(t, err)
-		require.EqualError(t, f.Truncate(0), ErrNotSupported.Error())
+		require.Equal(t, ErrNotSupported, f.Truncate(2))
+		require.NoError(t, f.Close())
+	})
+}
+
+func TestCaching(t *testing.T) {
+	driver := setup(t)
+	require.NoError(t, Caching(cache.Config{MaxEntries: 2})(driver))
+
+	mustWriteFile(t, driver, "Folder1/File1")
+	mustWriteFile(t, driver, "Folder2/File2")
+
+	require.NoError(t, getError(driver.Stat("Folder1/File1")))
+	require.NoError(t, getError(driver.Stat("Folder1/File1")))
+	require.NoError(t, getError(driver.Stat("Folder2/File2")))
+
+	stats := driver.CacheStats()
+	require.NotZero(t, stats.Hits)
+	require.NotZero(t, stats.Evictions)
+	require.LessOrEqual(t, stats.Entries, 2)
+
+	mustReadFileContent(t, driver, "Folder2/File2", "Hello World")
+}
+
+func TestListingCache(t *testing.T) {
+	driver := setup(t)
+
+	mustWriteFile(t, driver, "Folder1/File1")
+	mustWriteFileContent(t, driver, "Folder1/File2", "Hello")
+
+	listCalls := func() int32 {
+		return atomic.LoadInt32(driver.srvWrapper.calls["Files.List"])
+	}
+
+	listNames := func(t *testing.T, path string) []string {
+		dir, err := driver.Open(path)
+		require.NoError(t, err)
+
+		names, err := dir.Readdirnames(-1)
+		require.NoError(t, err)
+
+		return names
+	}
+
+	t.Run("siblings", func(t *testing.T) {
+		driver.srvWrapper.cache.CleanupEverything()
+
+		// The listings of the root directory and of Folder1
+		calls := listCalls()
+		require.NoError(t, getError(driver.Stat("Folder1/File1")))
+		require.Equal(t, calls+2, listCalls())
+
+		fi, err := driver.Stat("Folder1/File2")
+		require.NoError(t, err)
+		require.EqualValues(t, 5, fi.Size())
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File3"))))
+		require.Equal(t, []string{"File1", "File2"}, listNames(t, "Folder1"))
+		require.Equal(t, calls+2, listCalls())
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		calls := listCalls()
+
+		mustWriteFileContent(t, driver, "Folder1/File3", "Hello World!")
+		require.NoError(t, driver.Rename("Folder1/File1", "Folder1/File4"))
+		require.NoError(t, driver.Remove("Folder1/File2"))
+
+		require.Equal(t, []string{"File3", "File4"}, listNames(t, "Folder1"))
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File1"))))
+
+		fi, err := driver.Stat("Folder1/File3")
+		require.NoError(t, err)
+		require.EqualValues(t, 12, fi.Size())
+		require.Equal(t, calls, listCalls())
+
+		// The snapshot matches what is on the drive
+		driver.srvWrapper.cache.CleanupEverything()
+		require.Equal(t, []string{"File3", "File4"}, listNames(t, "Folder1"))
+	})
+}
+
+func TestPathCache(t *testing.T) {
+	driver := setup(t)
+
+	mustWriteFile(t, driver, "A/B/C/D/File1")
+
+	listCalls := func() int32 {
+		return atomic.LoadInt32(driver.srvWrapper.calls["Files.List"])
+	}
+
+	forgetListings := func() {
+		driver.srvWrapper.cache.CleanupFunc(func(key string, _ interface{}) bool {
+			return strings.HasSuffix(key, "-listFolder")
+		})
+	}
+
+	t.Run("deep path", func(t *testing.T) {
+		require.NoError(t, getError(driver.Stat("A/B/C/D/File1")))
+		forgetListings()
+
+		// Only the folder of the file is listed, whatever the requested fields are
+		calls := listCalls()
+		require.NoError(t, getError(driver.getFile("A/B/C/D/File1", "files(id,name)")))
+		require.Equal(t, calls+1, listCalls())
+		require.NoError(t, getError(driver.Stat("A/B/C/D/File1")))
+		require.Equal(t, calls+1, listCalls())
+	})
+
+	t.Run("renamed directory", func(t *testing.T) {
+		require.NoError(t, driver.Rename("A/B", "A/E"))
+		forgetListings()
+
+		require.True(t, IsNotExist(getError(driver.Stat("A/B/C/D/File1"))))
+		require.NoError(t, getError(driver.Stat("A/E/C/D/File1")))
+	})
+
+	t.Run("deleted directory", func(t *testing.T) {
+		require.NoError(t, driver.RemoveAll("A/E/C"))
+		forgetListings()
+
+		require.True(t, IsNotExist(getError(driver.Stat("A/E/C/D/File1"))))
+	})
+}
+
+func TestGoogleDocs(t *testing.T) {
+	driver := setup(t)
+	require.NoError(t, GoogleDocsExport(map[string]ExportFormat{MimeTypeDocument: ExportText})(driver))
+
+	_, err := driver.srv.Files.Create(&drive.File{
+		Name:     "Doc1",
+		MimeType: MimeTypeDocument,
+		Parents:  []string{driver.rootNode.file.Id},
+	}).Media(strings.NewReader("Hello World"), googleapi.ContentType("text/plain")).Do()
+	require.NoError(t, err)
+
+	listNames := func(t *testing.T) []string {
+		dir, err := driver.Open("/")
+		require.NoError(t, err)
+
+		names, err := dir.Readdirnames(-1)
+		require.NoError(t, err)
+
+		return names
+	}
+
+	t.Run("listing", func(t *testing.T) {
+		require.Equal(t, []string{"Doc1.txt"}, listNames(t))
+
+		fi, err := driver.Stat("Doc1.txt")
+		require.NoError(t, err)
+		require.False(t, fi.IsDir())
+		require.Equal(t, "Doc1.txt", fi.Name())
+	})
+
+	t.Run("read", func(t *testing.T) {
+		f, err := driver.Open("Doc1.txt")
+		require.NoError(t, err)
+
+		content, err := ioutil.ReadAll(f)
+		require.NoError(t, err)
+		require.Contains(t, string(content), "Hello World")
+
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), fi.Size())
+		require.NoError(t, f.Close())
+
+		// The size of the export is now known
+		fi, err = driver.Stat("Doc1.txt")
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), fi.Size())
+
+		// The ranged reads don't export the unchanged document again
+		counter := &downloadCounter{base: driver.client.Transport}
+		driver.client.Transport = counter
+
+		defer func() { driver.client.Transport = counter.base }()
+
+		f, err = driver.Open("Doc1.txt")
+		require.NoError(t, err)
+
+		buf := make([]byte, 5)
+		_, err = f.ReadAt(buf, int64(strings.Index(string(content), "World")))
+		require.NoError(t, err)
+		require.Equal(t, "World", string(buf))
+		require.NoError(t, f.Close())
+		require.Zero(t, counter.count())
+	})
+
+	t.Run("write", func(t *testing.T) {
+		_, err := driver.OpenFile("Doc1.txt", os.O_WRONLY, os.FileMode(0))
+		require.Equal(t, ErrNotSupported, err)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		require.NoError(t, driver.Rename("Doc1.txt", "Doc2.txt"))
+		require.Equal(t, []string{"Doc2.txt"}, listNames(t))
+	})
+
+	t.Run("hidden", func(t *testing.T) {
+		require.NoError(t, HideGoogleDocs()(driver))
+		defer func() { driver.HideGoogleDocs = false }()
+
+		require.Empty(t, listNames(t))
+	})
+
+	t.Run("no export format", func(t *testing.T) {
+		require.NoError(t, GoogleDocsExport(nil)(driver))
+
+		_, err := driver.Open("Doc2")
+		require.Equal(t, ErrNotExportable, err)
 	})
 }
 
@@ -899,6 +1483,17 @@ func mustWriteFile(t *testing.T, driver afero.Fs, path string) {
 	mustWriteFileContent(t, driver, path, "Hello World")
 }
 
+func mustReadFileContent(t *testing.T, driver afero.Fs, path string, content string) {
+	r, err := driver.Open(path)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, r.Close()) }()
+
+	received, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, string(received))
+}
+
 func mustCreateDir(t *testing.T, driver afero.Fs, path string) {
 	require.NoError(t, driver.Mkdir(path, os.FileMode(0)))
 }
@@ -0,0 +1,189 @@
+package iohelper // nolint: golint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ErrNegativeOffset is returned when a negative offset or size is passed to a SpoolFile
+var ErrNegativeOffset = errors.New("negative offset")
+
+// SpoolFile is a random-access buffer. It is kept in memory until it grows past a size limit, its content is then
+// moved to a temporary file.
+type SpoolFile struct {
+	mem      []byte   // mem is the content while it's kept in memory
+	disk     *os.File // disk is the temporary file used once the memory limit has been reached
+	dir      string   // dir is the directory in which the temporary file is created
+	memLimit int64    // memLimit is the size after which the content is moved to disk
+	size     int64    // size is the current size of the content
+}
+
+// NewSpoolFile creates a new SpoolFile. The content will be kept in memory up to memLimit bytes, and then moved to
+// a temporary file in dir (or the default temporary directory if dir is empty).
+func NewSpoolFile(dir string, memLimit int64) *SpoolFile {
+	return &SpoolFile{
+		dir:      dir,
+		memLimit: memLimit,
+	}
+}
+
+// Size returns the size of the content
+func (s *SpoolFile) Size() int64 {
+	return s.size
+}
+
+// ReadAt reads len(p) bytes starting at offset off
+func (s *SpoolFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	if s.disk != nil {
+		return s.disk.ReadAt(p, off)
+	}
+
+	if off >= s.size {
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.mem[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// WriteAt writes len(p) bytes starting at offset off. Writing past the end of the content grows it, the gap
+// being filled with zeros.
+func (s *SpoolFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+
+	end := off + int64(len(p))
+
+	if err := s.grow(end); err != nil {
+		return 0, err
+	}
+
+	if s.disk != nil {
+		n, err := s.disk.WriteAt(p, off)
+		if written := off + int64(n); written > s.size {
+			s.size = written
+		}
+
+		return n, err
+	}
+
+	if end > s.size {
+		s.mem = append(s.mem, make([]byte, end-s.size)...)
+		s.size = end
+	}
+
+	return copy(s.mem[off:], p), nil
+}
+
+// ReadFrom appends the content of r
+func (s *SpoolFile) ReadFrom(r io.Reader) (int64, error) {
+	buffer := make([]byte, writeBufferSize)
+	total := int64(0)
+
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			written, errWrite := s.WriteAt(buffer[:n], s.size)
+			total += int64(written)
+
+			if errWrite != nil {
+				return total, errWrite
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return total, nil
+		}
+
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Truncate changes the size of the content
+func (s *SpoolFile) Truncate(size int64) error {
+	if size < 0 {
+		return ErrNegativeOffset
+	}
+
+	if err := s.grow(size); err != nil {
+		return err
+	}
+
+	if s.disk != nil {
+		if err := s.disk.Truncate(size); err != nil {
+			return err
+		}
+	} else if size < s.size {
+		s.mem = s.mem[:size]
+	} else {
+		s.mem = append(s.mem, make([]byte, size-s.size)...)
+	}
+
+	s.size = size
+
+	return nil
+}
+
+// Reader returns a reader of the whole content
+func (s *SpoolFile) Reader() io.Reader {
+	return io.NewSectionReader(s, 0, s.size)
+}
+
+// Close releases the memory and deletes the temporary file
+func (s *SpoolFile) Close() error {
+	s.mem = nil
+	s.size = 0
+
+	if s.disk == nil {
+		return nil
+	}
+
+	disk := s.disk
+	s.disk = nil
+
+	errClose := disk.Close()
+
+	if err := os.Remove(disk.Name()); err != nil {
+		return err
+	}
+
+	return errClose
+}
+
+// grow moves the content to disk if it's about to grow past the memory limit
+func (s *SpoolFile) grow(size int64) error {
+	if s.disk != nil || size <= s.memLimit {
+		return nil
+	}
+
+	disk, err := ioutil.TempFile(s.dir, "spool-")
+	if err != nil {
+		return fmt.Errorf("couldn't create spool file: %w", err)
+	}
+
+	if _, err := disk.Write(s.mem); err != nil {
+		_ = disk.Close()
+		_ = os.Remove(disk.Name())
+
+		return fmt.Errorf("couldn't write spool file: %w", err)
+	}
+
+	s.disk = disk
+	s.mem = nil
+
+	return nil
+}
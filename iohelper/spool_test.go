@@ -0,0 +1,80 @@
+package iohelper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolFile(t *testing.T) {
+	for name, memLimit := range map[string]int64{"memory": 1024, "disk": 0, "spill": 8} {
+		memLimit := memLimit
+
+		t.Run(name, func(t *testing.T) {
+			req := require.New(t)
+			s := NewSpoolFile("", memLimit)
+
+			n, err := s.ReadFrom(bytes.NewReader([]byte("Hello World")))
+			req.NoError(err)
+			req.EqualValues(11, n)
+
+			_, err = s.WriteAt([]byte("Earth"), 6)
+			req.NoError(err)
+
+			_, err = s.WriteAt([]byte("!"), 13)
+			req.NoError(err)
+			req.EqualValues(14, s.Size())
+
+			content, err := ioutil.ReadAll(s.Reader())
+			req.NoError(err)
+			req.Equal("Hello Earth\x00\x00!", string(content))
+
+			req.NoError(s.Truncate(5))
+			buffer := make([]byte, 10)
+			n2, err := s.ReadAt(buffer, 0)
+			req.Error(err)
+			req.Equal("Hello", string(buffer[:n2]))
+
+			var diskName string
+			if s.disk != nil {
+				diskName = s.disk.Name()
+			}
+
+			req.NoError(s.Close())
+
+			if diskName != "" {
+				_, err = os.Stat(diskName)
+				req.True(os.IsNotExist(err))
+			}
+		})
+	}
+
+	t.Run("disk write in the middle", func(t *testing.T) {
+		s := NewSpoolFile("", 0)
+
+		defer func() { require.NoError(t, s.Close()) }()
+
+		_, err := s.ReadFrom(bytes.NewReader([]byte("Hello World")))
+		require.NoError(t, err)
+		require.NotNil(t, s.disk)
+
+		n, err := s.WriteAt([]byte("y"), 4)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		require.EqualValues(t, 11, s.Size())
+
+		content, err := ioutil.ReadAll(s.Reader())
+		require.NoError(t, err)
+		require.Equal(t, "Helly World", string(content))
+	})
+
+	t.Run("negative offset", func(t *testing.T) {
+		s := NewSpoolFile("", 0)
+		_, err := s.WriteAt([]byte("a"), -1)
+		require.Equal(t, ErrNegativeOffset, err)
+		require.Equal(t, ErrNegativeOffset, s.Truncate(-1))
+	})
+}
@@ -0,0 +1,255 @@
+package gdrive // nolint: golint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// listingFileFields are the fields of the files kept in the folder listings. They are a superset of the fields
+// requested by the lookups of the driver, so that any of them can be answered from a listing.
+var listingFileFields = []googleapi.Field{
+	"capabilities(canEdit)",
+	"createdTime",
+	"driveId",
+	"id",
+	"md5Checksum",
+	"mimeType",
+	"modifiedTime",
+	"name",
+	"parents",
+	"permissionIds",
+	"properties",
+	"size",
+}
+
+// listingFields are the fields requested when listing a folder
+var listingFields = googleapi.Field(
+	fmt.Sprintf("nextPageToken,files(%s)", googleapi.CombineFields(listingFileFields)),
+)
+
+// folderListing is the cached snapshot of the children of a folder. It's never modified once cached: the writes
+// replace it with an updated copy.
+type folderListing struct {
+	files  []*drive.File            // files are the children of the folder, sorted by name
+	byName map[string][]*drive.File // byName indexes the children by their lower-cased name
+}
+
+func newFolderListing(files []*drive.File) *folderListing {
+	if files == nil {
+		files = []*drive.File{}
+	}
+
+	l := &folderListing{
+		files:  files,
+		byName: make(map[string][]*drive.File, len(files)),
+	}
+
+	for _, f := range files {
+		key := strings.ToLower(f.Name)
+		l.byName[key] = append(l.byName[key], f)
+	}
+
+	return l
+}
+
+// lookup returns the children having a name. Like the name queries of Google Drive, the comparison ignores the case,
+// and nothing found is a valid (negative) answer.
+func (l *folderListing) lookup(name string) []*drive.File {
+	return l.byName[strings.ToLower(sanitizeName(name))]
+}
+
+// listingsState allows to update the listings consistently, it's shared by the wrappers bound to other contexts
+type listingsState struct {
+	mutex      sync.Mutex // mutex serializes the updates of the listings
+	generation int64      // generation is incremented by each update, to discard the listings fetched meanwhile
+}
+
+func listingKey(folderID string) string {
+	return fmt.Sprintf("%s-listFolder", folderID)
+}
+
+// coveredByListing returns true if the fields requested by a lookup are all part of the listings
+func coveredByListing(fields string) bool {
+	fields = strings.TrimSuffix(strings.TrimPrefix(fields, "files("), ")")
+
+	for _, field := range strings.Split(fields, ",") {
+		found := false
+
+		for _, f := range listingFileFields {
+			if string(f) == strings.TrimSpace(field) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lessByName sorts the files like the listings ordered by name
+func lessByName(a, b *drive.File) bool {
+	if na, nb := strings.ToLower(a.Name), strings.ToLower(b.Name); na != nb {
+		return na < nb
+	}
+
+	return a.Id < b.Id
+}
+
+// listFolder returns the snapshot of the children of a folder. If it isn't cached, it's fetched with one paged
+// listing of the folder.
+func (a *APIWrapper) listFolder(folder *drive.File) (*folderListing, error) {
+	key := listingKey(folder.Id)
+
+	if value, ok := a.cache.Get(key); ok {
+		return value.(*folderListing), nil
+	}
+
+	a.listings.mutex.Lock()
+	generation := a.listings.generation
+	listing := a.loadListing(folder.Id)
+	a.listings.mutex.Unlock()
+
+	if listing != nil {
+		return listing, nil
+	}
+
+	var files []*drive.File
+
+	pageToken := ""
+
+	for {
+		call := inDrive(a.srv.Files.List(), folder.DriveId).
+			Q(fmt.Sprintf("'%s' in parents and trashed = false", folder.Id)).
+			Fields(listingFields).
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			OrderBy("name").
+			PageSize(filesListPageSizeMax)
+
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var list *drive.FileList
+
+		a.calling("Files.List")
+
+		err := a.callAPI(CallRead, true, func() error {
+			var err error
+			list, err = call.Context(a.context()).Do()
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The files are in the drive of their folder, even if it wasn't returned
+		for _, f := range list.Files {
+			f.DriveId = folder.DriveId
+		}
+
+		files = append(files, list.Files...)
+
+		if pageToken = list.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return lessByName(files[i], files[j]) })
+
+	listing = newFolderListing(files)
+
+	// A listing fetched while the folders were updated might already be stale
+	a.listings.mutex.Lock()
+	if a.UseCache && a.listings.generation == generation {
+		a.cache.SetTagged(key, listing, fileIDs(listing.files)...)
+		a.persistListing(folder.Id, listing.files)
+	}
+	a.listings.mutex.Unlock()
+
+	return listing, nil
+}
+
+// updateListing replaces the snapshot of a folder, if it's cached or persisted, with an updated copy. The name lookups
+// that were done in the folder without its listing are evicted.
+func (a *APIWrapper) updateListing(folderID string, update func(files []*drive.File) []*drive.File) {
+	a.listings.mutex.Lock()
+	defer a.listings.mutex.Unlock()
+
+	a.listings.generation++
+
+	a.cache.CleanupByPrefix(fmt.Sprintf("%s-getFileByFolderAndName-", folderID))
+
+	var listing *folderListing
+
+	if value, ok := a.cache.Get(listingKey(folderID)); ok {
+		listing = value.(*folderListing)
+	} else if listing = a.loadListing(folderID); listing == nil {
+		return
+	}
+
+	files := make([]*drive.File, len(listing.files))
+	copy(files, listing.files)
+
+	listing = newFolderListing(update(files))
+	a.cache.SetTagged(listingKey(folderID), listing, fileIDs(listing.files)...)
+	a.persistListing(folderID, listing.files)
+}
+
+// addToListing adds a file to the snapshot of a folder, or replaces its previous version
+func (a *APIWrapper) addToListing(folderID string, file *drive.File) {
+	a.updateListing(folderID, func(files []*drive.File) []*drive.File {
+		files = withoutFile(files, file.Id)
+		i := sort.Search(len(files), func(i int) bool { return !lessByName(files[i], file) })
+		files = append(files, nil)
+		copy(files[i+1:], files[i:])
+		files[i] = file
+
+		return files
+	})
+}
+
+// removeFromListing removes a file from the snapshot of a folder
+func (a *APIWrapper) removeFromListing(folderID string, fileID string) {
+	a.updateListing(folderID, func(files []*drive.File) []*drive.File {
+		return withoutFile(files, fileID)
+	})
+}
+
+// fileUpdated updates the snapshots of the folders of a file whose content or metadata was changed. The file has to
+// be returned with the listing fields, its parents can be omitted.
+func (a *APIWrapper) fileUpdated(file *drive.File, parents []string) {
+	if file == nil {
+		return
+	}
+
+	if len(file.Parents) == 0 {
+		file.Parents = parents
+	}
+
+	for _, p := range file.Parents {
+		a.addToListing(p, file)
+	}
+}
+
+func withoutFile(files []*drive.File, fileID string) []*drive.File {
+	kept := files[:0]
+
+	for _, f := range files {
+		if f.Id != fileID {
+			kept = append(kept, f)
+		}
+	}
+
+	return kept
+}
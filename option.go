@@ -1,5 +1,11 @@
 package gdrive // nolint: golint
 
+import (
+	"github.com/jonny5532/afero-gdrive/blockcache"
+	"github.com/jonny5532/afero-gdrive/cache"
+	"github.com/jonny5532/afero-gdrive/log"
+)
+
 // Option can be used to pass optional Options to GDriver
 type Option func(driver *GDriver) error
 
@@ -21,4 +27,191 @@ func RootNode(id string) Option {
 		_, err = driver.SetRootDirectory("")
 		return err
 	}
-}
\ No newline at end of file
+}
+
+// Logger sets the logger of the driver, and of the API calls it makes
+func Logger(logger log.Logger) Option {
+	return func(driver *GDriver) error {
+		driver.Logger = logger
+
+		return nil
+	}
+}
+
+// Spooling enables the O_RDWR and O_APPEND flags by working on a local copy of the files, which is uploaded when
+// the file is synced or closed. Copies are kept in memory up to memoryLimit bytes and then moved to a temporary file
+// in directory (or the default temporary directory if empty).
+func Spooling(directory string, memoryLimit int64) Option {
+	return func(driver *GDriver) error {
+		driver.SpoolFiles = true
+		driver.SpoolDirectory = directory
+		driver.SpoolMemoryLimit = memoryLimit
+
+		return nil
+	}
+}
+
+// RateLimiting sets the rate limiter of the driver, replacing the default token bucket. A nil limiter disables the
+// rate limiting.
+func RateLimiting(limiter RateLimiter) Option {
+	return func(driver *GDriver) error {
+		if limiter == nil {
+			limiter = noRateLimiter{}
+		}
+
+		driver.rateLimiter = limiter
+		driver.srvWrapper.limiter = limiter
+
+		return nil
+	}
+}
+
+// Retry sets the policy used to retry the API calls that failed with a transient error. A policy with MaxAttempts
+// set to 1 disables the retries.
+func Retry(policy RetryPolicy) Option {
+	return func(driver *GDriver) error {
+		driver.retryPolicy = &policy
+		driver.srvWrapper.retryPolicy = &policy
+
+		return nil
+	}
+}
+
+// ResumableUploads makes the files opened for writing use resumable uploads of chunkSize bytes (rounded to a
+// multiple of 256 KiB). Interrupted chunks are sent again, and the progress callback (if not nil) is called
+// with the session each time a chunk is acknowledged so that it can be persisted and resumed with ResumeUpload.
+func ResumableUploads(chunkSize int, progress func(path string, session UploadSession)) Option {
+	return func(driver *GDriver) error {
+		driver.UploadChunkSize = chunkSize
+		driver.UploadProgress = progress
+
+		return nil
+	}
+}
+
+// GoogleDocsExport sets the formats the Google-native documents (Docs, Sheets, Slides, Drawings) are exported to,
+// by their mime type. The documents are listed with the extension of their format. A nil map disables the exports.
+func GoogleDocsExport(formats map[string]ExportFormat) Option {
+	return func(driver *GDriver) error {
+		driver.ExportFormats = formats
+
+		return nil
+	}
+}
+
+// HideGoogleDocs hides the Google-native documents (Docs, Sheets, Forms, etc.) from the directory listings
+func HideGoogleDocs() Option {
+	return func(driver *GDriver) error {
+		driver.HideGoogleDocs = true
+
+		return nil
+	}
+}
+
+// SharedDrives makes the root directory a virtual directory containing "My Drive" and a directory for each shared
+// drive. The paths of the RootDirectory option then start with the name of a drive, so it should come after this one.
+func SharedDrives() Option {
+	return func(driver *GDriver) error {
+		driver.SharedDrives = true
+
+		_, err := driver.SetRootDirectory("")
+
+		return err
+	}
+}
+
+// ContentCache keeps the content read from the files in blocks of blockSize bytes (DefaultContentBlockSize if not
+// positive), stored in directory within maxBytes. The blocks are bound to a version of a file, so the reads of a file
+// that didn't change are served locally, and the missing blocks are fetched with ranged downloads.
+func ContentCache(directory string, maxBytes int64, blockSize int64) Option {
+	return func(driver *GDriver) error {
+		contentCache, err := blockcache.New(directory, maxBytes)
+		if err != nil {
+			return err
+		}
+
+		driver.contentCache = contentCache
+		driver.ContentBlockSize = blockSize
+
+		return nil
+	}
+}
+
+// ReadAhead makes the sequential reads prefetch concurrently up to ranges ranges of rangeSize bytes
+// (DefaultReadAheadSize if not positive) ahead of them, instead of reading a single download. It doesn't apply to the
+// exported documents, nor to the files read through the ContentCache. The prefetched ranges are cancelled when a seek
+// drops them, or when the file is closed.
+func ReadAhead(ranges int, rangeSize int64) Option {
+	return func(driver *GDriver) error {
+		driver.ReadAheadRanges = ranges
+		driver.ReadAheadSize = rangeSize
+
+		return nil
+	}
+}
+
+// ParallelDownloads makes the files larger than threshold bytes be read with ranges of rangeSize bytes
+// (DefaultParallelRangeSize if not positive) fetched by workers concurrent downloads, instead of a single one. They are
+// reassembled in order, with at most workers ranges in memory, and a range whose download fails is fetched again. Like
+// with ReadAhead, the downloads in progress are cancelled by a seek out of the fetched ranges and by closing the file.
+func ParallelDownloads(threshold int64, workers int, rangeSize int64) Option {
+	return func(driver *GDriver) error {
+		driver.ParallelDownloadThreshold = threshold
+		driver.ParallelDownloadWorkers = workers
+		driver.ParallelDownloadRangeSize = rangeSize
+
+		return nil
+	}
+}
+
+// Duplicates sets how the files having the same name in a folder are handled, instead of DuplicatesError
+func Duplicates(policy DuplicatePolicy) Option {
+	return func(driver *GDriver) error {
+		driver.Duplicates = policy
+
+		return nil
+	}
+}
+
+// Caching sets the limits of the cache of the path lookups, replacing DefaultCacheConfig. The lookups are also
+// invalidated by the changes done through the driver, and by the ChangeWatcher if one is used.
+func Caching(config cache.Config) Option {
+	return func(driver *GDriver) error {
+		driver.srvWrapper.cache = cache.NewCacheWithConfig(config)
+
+		return nil
+	}
+}
+
+// PersistentCache keeps the folder listings in a store (like a DiskCacheStore), so that a restarted driver starts
+// with a warm cache. The persisted listings are brought up to date by GDriver.WatchChanges, which should be called
+// right after the driver is created. They are discarded if no changes position was persisted with them.
+func PersistentCache(store CacheStore) Option {
+	return func(driver *GDriver) error {
+		token, err := store.GetPageToken()
+		if err != nil {
+			return err
+		}
+
+		if token == "" {
+			if err := store.Reset(); err != nil {
+				return err
+			}
+		}
+
+		driver.srvWrapper.store = store
+
+		return nil
+	}
+}
+
+// ModeSharing maps the modes to the sharing of the files: the read bit of the others set with Chmod shares the files
+// with anyone having the link (as readers), clearing it unshares them, and the write bits of their modes are only kept
+// if they can be edited. Beware that the usual modes like 0644 have this bit: a Chmod with them publishes the files.
+func ModeSharing() Option {
+	return func(driver *GDriver) error {
+		driver.ModeSharing = true
+
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package gdrive // nolint: golint
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// resolvedPath is the cached resolution of the path of a directory. It doesn't depend on the fields requested by the
+// lookups, only the directory it leads to is kept.
+type resolvedPath struct {
+	folder *drive.File // folder is the directory the path leads to
+	ids    []string    // ids are the IDs of the directories of the path, to evict it when one of them changes
+}
+
+// pathKey returns the cache key of the resolution of a path from a root folder. All the paths share the same bucket.
+func pathKey(rootID string, pathParts []string) string {
+	return fmt.Sprintf("path-%s/%s", rootID, strings.ToLower(strings.Join(pathParts, "/")))
+}
+
+// getResolvedPath returns the longest cached directory path, among the ancestors of a path
+func (a *APIWrapper) getResolvedPath(rootID string, pathParts []string) (*resolvedPath, int) {
+	for i := len(pathParts); i > 0; i-- {
+		if value, ok := a.cache.Get(pathKey(rootID, pathParts[:i])); ok {
+			return value.(*resolvedPath), i
+		}
+	}
+
+	return nil, 0
+}
+
+// setResolvedPath caches the resolution of a directory path, unless the folders were updated since the resolution
+// started
+func (a *APIWrapper) setResolvedPath(rootID string, pathParts []string, resolved *resolvedPath, generation int64) {
+	a.listings.mutex.Lock()
+	defer a.listings.mutex.Unlock()
+
+	if a.UseCache && a.listings.generation == generation {
+		a.cache.SetTagged(pathKey(rootID, pathParts), resolved, resolved.ids...)
+	}
+}
+
+// generation returns the current generation of the folders, it changes each time they're updated
+func (a *APIWrapper) generation() int64 {
+	a.listings.mutex.Lock()
+	defer a.listings.mutex.Unlock()
+
+	return a.listings.generation
+}
+
+// forgetResolvedPaths evicts the resolved paths going through a directory. They're tagged with the IDs of their
+// directories, only the entries having its ID are scanned.
+func (a *APIWrapper) forgetResolvedPaths(folderID string) {
+	a.listings.mutex.Lock()
+	defer a.listings.mutex.Unlock()
+
+	a.listings.generation++
+
+	a.cache.CleanupTagged(folderID, func(_ string, value interface{}) bool {
+		_, ok := value.(*resolvedPath)
+		return ok
+	})
+}
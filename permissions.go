@@ -0,0 +1,319 @@
+package gdrive // nolint: golint
+
+import (
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// PermissionType is the kind of grantee of a Permission
+type PermissionType string
+
+const (
+	// PermissionUser grants access to a user, identified by their email address
+	PermissionUser PermissionType = "user"
+	// PermissionGroup grants access to the members of a group, identified by its email address
+	PermissionGroup PermissionType = "group"
+	// PermissionDomain grants access to the users of a domain
+	PermissionDomain PermissionType = "domain"
+	// PermissionAnyone grants access to anyone, with the link or through the searches
+	PermissionAnyone PermissionType = "anyone"
+)
+
+// Role is the access granted by a Permission
+type Role string
+
+const (
+	// RoleReader allows to read the files
+	RoleReader Role = "reader"
+	// RoleCommenter allows to read and comment the files
+	RoleCommenter Role = "commenter"
+	// RoleWriter allows to read and change the files
+	RoleWriter Role = "writer"
+	// RoleFileOrganizer allows to organize the files of a shared drive
+	RoleFileOrganizer Role = "fileOrganizer"
+	// RoleOrganizer allows to organize the files and the members of a shared drive
+	RoleOrganizer Role = "organizer"
+	// RoleOwner transfers the ownership of the files
+	RoleOwner Role = "owner"
+)
+
+// permissionFields are the fields of the permissions
+const permissionFields = "id,type,role,emailAddress,domain,allowFileDiscovery,expirationTime,displayName"
+
+// The IDs Google Drive gives to the permissions of type anyone, depending on whether the files can be found by
+// searching
+const (
+	anyoneWithLinkID = "anyoneWithLink"
+	anyoneID         = "anyone"
+)
+
+// permissionsPageSizeMax is the largest page of permissions Google Drive returns
+const permissionsPageSizeMax = 100
+
+// Permission is an access granted on a file or a directory, the permissions of a directory apply to its content
+type Permission struct {
+	ID                 string         // ID identifies the permission, it's set by Google Drive
+	Type               PermissionType // Type is the kind of grantee
+	Role               Role           // Role is the access granted
+	EmailAddress       string         // EmailAddress identifies the user or the group
+	Domain             string         // Domain is the domain of a domain permission
+	AllowFileDiscovery bool           // AllowFileDiscovery lets the domain or anyone find the file by searching
+	ExpirationTime     time.Time      // ExpirationTime is when a user or group permission expires, never if zero
+	DisplayName        string         // DisplayName is the name of the grantee, it's set by Google Drive
+
+	// SendNotificationEmail makes Share send an email to the user or group the file is shared with
+	SendNotificationEmail bool
+	// EmailMessage is a message added to the notification email
+	EmailMessage string
+}
+
+// toDrive converts the permission to the fields sent to Google Drive
+func (p *Permission) toDrive() *drive.Permission {
+	permission := &drive.Permission{
+		Type:               string(p.Type),
+		Role:               string(p.Role),
+		EmailAddress:       p.EmailAddress,
+		Domain:             p.Domain,
+		AllowFileDiscovery: p.AllowFileDiscovery,
+	}
+
+	if !p.ExpirationTime.IsZero() {
+		permission.ExpirationTime = p.ExpirationTime.UTC().Format(time.RFC3339)
+	}
+
+	return permission
+}
+
+// notifies returns true if the permission is for a user or a group, the only grantees that can be notified
+func (p *Permission) notifies() bool {
+	return p.Type == PermissionUser || p.Type == PermissionGroup
+}
+
+func newPermission(p *drive.Permission) *Permission {
+	expirationTime, _ := time.Parse(time.RFC3339, p.ExpirationTime)
+
+	return &Permission{
+		ID:                 p.Id,
+		Type:               PermissionType(p.Type),
+		Role:               Role(p.Role),
+		EmailAddress:       p.EmailAddress,
+		Domain:             p.Domain,
+		AllowFileDiscovery: p.AllowFileDiscovery,
+		ExpirationTime:     expirationTime,
+		DisplayName:        p.DisplayName,
+	}
+}
+
+// getSharedFile returns the file or directory whose permissions are managed
+func (d *GDriver) getSharedFile(path string) (*FileInfo, error) {
+	fi, err := d.getFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.isVirtual() {
+		return nil, ErrForbiddenOnRoot
+	}
+
+	return fi, nil
+}
+
+// Share grants a permission on a file or a directory, and returns it with its ID. Sharing again with the same grantee
+// changes their permission. The users and groups are only notified if SendNotificationEmail is set.
+func (d *GDriver) Share(path string, permission Permission) (*Permission, error) {
+	fi, err := d.getSharedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := d.share(fi, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	d.permissionsChanged(fi)
+
+	return created, nil
+}
+
+func (d *GDriver) share(fi *FileInfo, permission Permission) (*Permission, error) {
+	call := d.srv.Permissions.Create(fi.file.Id, permission.toDrive()).
+		Fields(permissionFields).
+		SupportsAllDrives(true)
+
+	if permission.notifies() {
+		call = call.SendNotificationEmail(permission.SendNotificationEmail)
+
+		if permission.SendNotificationEmail && permission.EmailMessage != "" {
+			call = call.EmailMessage(permission.EmailMessage)
+		}
+	}
+
+	if permission.Role == RoleOwner {
+		call = call.TransferOwnership(true)
+	}
+
+	var created *drive.Permission
+
+	// The notification could be sent twice
+	err := d.callAPI(CallWrite, false, func() error {
+		var err error
+		created, err = call.Context(d.Context()).Do()
+
+		return err
+	})
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	return newPermission(created), nil
+}
+
+// ListPermissions lists the permissions of a file or a directory, including the ones it inherits from its directory
+func (d *GDriver) ListPermissions(path string) ([]*Permission, error) {
+	fi, err := d.getSharedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.listPermissions(fi)
+}
+
+func (d *GDriver) listPermissions(fi *FileInfo) ([]*Permission, error) {
+	var permissions []*Permission
+
+	pageToken := ""
+
+	for {
+		call := d.srv.Permissions.List(fi.file.Id).
+			Fields(googleapi.Field("nextPageToken,permissions(" + permissionFields + ")")).
+			SupportsAllDrives(true).
+			PageSize(permissionsPageSizeMax)
+
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		var list *drive.PermissionList
+
+		err := d.callAPI(CallRead, true, func() error {
+			var err error
+			list, err = call.Context(d.Context()).Do()
+
+			return err
+		})
+		if err != nil {
+			return nil, &DriveAPICallError{Err: err}
+		}
+
+		for _, p := range list.Permissions {
+			permissions = append(permissions, newPermission(p))
+		}
+
+		if pageToken = list.NextPageToken; pageToken == "" {
+			return permissions, nil
+		}
+	}
+}
+
+// UpdatePermission changes the role and the expiration time of the permission of a file or a directory identified by
+// the ID of the given permission, its other fields can't be changed. A zero expiration time removes the expiration.
+func (d *GDriver) UpdatePermission(path string, permission Permission) (*Permission, error) {
+	if permission.ID == "" {
+		return nil, ErrMissingPermissionID
+	}
+
+	fi, err := d.getSharedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &drive.Permission{Role: string(permission.Role)}
+
+	call := d.srv.Permissions.Update(fi.file.Id, permission.ID, update).
+		Fields(permissionFields).
+		SupportsAllDrives(true)
+
+	if permission.ExpirationTime.IsZero() {
+		call = call.RemoveExpiration(true)
+	} else {
+		update.ExpirationTime = permission.ExpirationTime.UTC().Format(time.RFC3339)
+	}
+
+	if permission.Role == RoleOwner {
+		call = call.TransferOwnership(true)
+	}
+
+	var updated *drive.Permission
+
+	err = d.callAPI(CallWrite, true, func() error {
+		var err error
+		updated, err = call.Context(d.Context()).Do()
+
+		return err
+	})
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	return newPermission(updated), nil
+}
+
+// Unshare deletes a permission of a file or a directory
+func (d *GDriver) Unshare(path string, permissionID string) error {
+	fi, err := d.getSharedFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := d.unshare(fi, permissionID); err != nil {
+		return err
+	}
+
+	d.permissionsChanged(fi)
+
+	return nil
+}
+
+func (d *GDriver) unshare(fi *FileInfo, permissionID string) error {
+	// A deletion that failed in the middle could make the retry fail with a "not found" error
+	err := d.callAPI(CallWrite, false, func() error {
+		return d.srv.Permissions.Delete(fi.file.Id, permissionID).
+			SupportsAllDrives(true).
+			Context(d.Context()).
+			Do()
+	})
+	if err != nil {
+		return &DriveAPICallError{Err: err}
+	}
+
+	return nil
+}
+
+// permissionsChanged fetches the metadata of a file whose permissions changed, and updates the listings of its folders
+// with it: its permission IDs and capabilities depend on them. If it can't be fetched, the lookups that found the file
+// are evicted.
+func (d *GDriver) permissionsChanged(fi *FileInfo) {
+	var file *drive.File
+
+	err := d.callAPI(CallRead, true, func() error {
+		var err error
+		file, err = d.srv.Files.Get(fi.file.Id).
+			Fields(fileInfoFields...).
+			SupportsAllDrives(true).
+			Context(d.Context()).
+			Do()
+
+		return err
+	})
+	if err != nil {
+		d.Logger.Warn("Couldn't fetch a shared file", "fileId", fi.file.Id, "err", err)
+		d.srvWrapper.forgetFile(fi.file.Id)
+
+		return
+	}
+
+	d.srvWrapper.fileUpdated(file, fi.file.Parents)
+}
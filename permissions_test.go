@@ -0,0 +1,159 @@
+package gdrive
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jonny5532/afero-gdrive/drivetest"
+)
+
+func TestPermissions(t *testing.T) {
+	driver, server := setupFake(t)
+
+	mustWriteFileContent(t, driver, "Artifacts/build.zip", "zip")
+
+	t.Run("share", func(t *testing.T) {
+		expiration := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+		reader, err := driver.Share("Artifacts", Permission{
+			Type:           PermissionUser,
+			Role:           RoleReader,
+			EmailAddress:   "reader@example.com",
+			ExpirationTime: expiration,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, reader.ID)
+		require.True(t, expiration.Equal(reader.ExpirationTime))
+		require.Empty(t, server.Notifications())
+
+		_, err = driver.Share("Artifacts/build.zip", Permission{
+			Type:                  PermissionGroup,
+			Role:                  RoleCommenter,
+			EmailAddress:          "team@example.com",
+			SendNotificationEmail: true,
+			EmailMessage:          "The new build",
+		})
+		require.NoError(t, err)
+
+		fi, err := driver.Stat("Artifacts/build.zip")
+		require.NoError(t, err)
+		require.Equal(t, []drivetest.Notification{{
+			FileID:       fi.(*FileInfo).DriveFile().Id,
+			EmailAddress: "team@example.com",
+			Message:      "The new build",
+		}}, server.Notifications())
+
+		anyone, err := driver.Share("Artifacts/build.zip", Permission{Type: PermissionAnyone, Role: RoleReader})
+		require.NoError(t, err)
+		require.Equal(t, PermissionAnyone, anyone.Type)
+
+		// The cached metadata of the file has the new permissions
+		fi, err = driver.Stat("Artifacts/build.zip")
+		require.NoError(t, err)
+		require.Contains(t, fi.(*FileInfo).DriveFile().PermissionIds, anyone.ID)
+
+		// The expiration times are only allowed on the permissions of the users and groups
+		_, err = driver.Share("Artifacts", Permission{
+			Type:           PermissionDomain,
+			Role:           RoleReader,
+			Domain:         "example.com",
+			ExpirationTime: expiration,
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		permissions, err := driver.ListPermissions("Artifacts")
+		require.NoError(t, err)
+		require.Len(t, permissions, 1)
+
+		permission := permissions[0]
+		require.Equal(t, "reader@example.com", permission.EmailAddress)
+		require.False(t, permission.ExpirationTime.IsZero())
+
+		permission.Role = RoleWriter
+		permission.ExpirationTime = time.Time{}
+
+		updated, err := driver.UpdatePermission("Artifacts", *permission)
+		require.NoError(t, err)
+		require.Equal(t, RoleWriter, updated.Role)
+		require.True(t, updated.ExpirationTime.IsZero())
+
+		_, err = driver.UpdatePermission("Artifacts", Permission{Role: RoleReader})
+		require.Equal(t, ErrMissingPermissionID, err)
+	})
+
+	t.Run("unshare", func(t *testing.T) {
+		permissions, err := driver.ListPermissions("Artifacts/build.zip")
+		require.NoError(t, err)
+		require.Len(t, permissions, 2)
+
+		for _, permission := range permissions {
+			require.NoError(t, driver.Unshare("Artifacts/build.zip", permission.ID))
+		}
+
+		permissions, err = driver.ListPermissions("Artifacts/build.zip")
+		require.NoError(t, err)
+		require.Empty(t, permissions)
+
+		fi, err := driver.Stat("Artifacts/build.zip")
+		require.NoError(t, err)
+		require.Empty(t, fi.(*FileInfo).DriveFile().PermissionIds)
+
+		require.Error(t, driver.Unshare("Artifacts/build.zip", "unknown"))
+		require.True(t, IsNotExist(driver.Unshare("Other", "unknown")))
+	})
+}
+
+func TestModeSharing(t *testing.T) {
+	// The files shared on a real drive also have the permission of their owner
+	driver, _ := setupFake(t, ModeSharing())
+
+	mode := func(path string) os.FileMode {
+		fi, err := driver.Stat(path)
+		require.NoError(t, err)
+
+		return fi.Mode()
+	}
+
+	mustWriteFileContent(t, driver, "Folder/File", "content")
+
+	// The files can be edited, but they aren't shared
+	require.Equal(t, os.FileMode(0640), mode("Folder/File"))
+	require.Equal(t, os.ModeDir|0751, mode("Folder"))
+
+	require.NoError(t, driver.Chmod("Folder/File", 0640))
+	require.Equal(t, os.FileMode(0640), mode("Folder/File"))
+
+	permissions, err := driver.ListPermissions("Folder/File")
+	require.NoError(t, err)
+	require.Empty(t, permissions)
+
+	require.NoError(t, driver.Chmod("Folder/File", 0644))
+	require.Equal(t, os.FileMode(0644), mode("Folder/File"))
+
+	permissions, err = driver.ListPermissions("Folder/File")
+	require.NoError(t, err)
+	require.Len(t, permissions, 1)
+	require.Equal(t, PermissionAnyone, permissions[0].Type)
+	require.Equal(t, RoleReader, permissions[0].Role)
+
+	// Setting the bit again keeps the permission
+	require.NoError(t, driver.Chmod("Folder/File", 0664))
+	require.Equal(t, os.FileMode(0664), mode("Folder/File"))
+
+	require.NoError(t, driver.Chmod("Folder/File", 0600))
+	require.Equal(t, os.FileMode(0600), mode("Folder/File"))
+
+	permissions, err = driver.ListPermissions("Folder/File")
+	require.NoError(t, err)
+	require.Empty(t, permissions)
+
+	// The bit reflects the permissions given without Chmod too
+	_, err = driver.Share("Folder/File", Permission{Type: PermissionAnyone, Role: RoleReader})
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0604), mode("Folder/File"))
+}
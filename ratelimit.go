@@ -0,0 +1,166 @@
+package gdrive // nolint: golint
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CallKind is the kind of API call that is rate limited
+type CallKind int
+
+const (
+	// CallRead is a call that only reads data (Files.Get, Files.List, downloads)
+	CallRead CallKind = iota
+	// CallWrite is a call that changes data (Files.Create, Files.Update, Files.Delete, uploads)
+	CallWrite
+)
+
+// RateLimiter limits the rate of the calls made to the Google Drive API
+type RateLimiter interface {
+	// Wait blocks until a call of the given kind can be made. It returns the context error if the context is done
+	// before that.
+	Wait(ctx context.Context, kind CallKind) error
+}
+
+// TokenBucketConfig defines the budgets of a TokenBucket. A rate of zero (or less) means no limit.
+type TokenBucketConfig struct {
+	ReadRate   float64 // ReadRate is the number of read calls allowed per second
+	ReadBurst  int     // ReadBurst is the number of read calls that can be made at once
+	WriteRate  float64 // WriteRate is the number of write calls allowed per second
+	WriteBurst int     // WriteBurst is the number of write calls that can be made at once
+}
+
+// DefaultTokenBucketConfig is the configuration of the rate limiter each driver gets by default. It stays below
+// the default per-user quotas of Google Drive (around 10 requests and 3 sustained writes per second).
+var DefaultTokenBucketConfig = TokenBucketConfig{
+	ReadRate:   10,
+	ReadBurst:  10,
+	WriteRate:  3,
+	WriteBurst: 3,
+}
+
+// TokenBucket is a RateLimiter with separate budgets for reads and writes
+type TokenBucket struct {
+	read  *bucket
+	write *bucket
+}
+
+// NewTokenBucket creates a new TokenBucket
+func NewTokenBucket(config TokenBucketConfig) *TokenBucket {
+	return &TokenBucket{
+		read:  newBucket(config.ReadRate, config.ReadBurst),
+		write: newBucket(config.WriteRate, config.WriteBurst),
+	}
+}
+
+// Wait blocks until a token is available in the budget of the call kind
+func (tb *TokenBucket) Wait(ctx context.Context, kind CallKind) error {
+	if kind == CallWrite {
+		return tb.write.wait(ctx)
+	}
+
+	return tb.read.wait(ctx)
+}
+
+// bucket is a single token bucket
+type bucket struct {
+	mu     sync.Mutex // mu protects everything below
+	rate   float64    // rate is the number of tokens added per second
+	burst  float64    // burst is the maximum number of tokens
+	tokens float64    // tokens is the number of tokens available
+	last   time.Time  // last is the last time tokens were added
+}
+
+func newBucket(rate float64, burst int) *bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token if one is available, otherwise it returns the time to wait for the next one
+func (b *bucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.last = now
+
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return ctx.Err()
+	}
+
+	for {
+		delay := b.reserve()
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// UserRateLimiters shares rate limiters between the drivers using the same Google account, as the quotas are
+// enforced per user. Drivers using different accounts don't throttle each other.
+type UserRateLimiters struct {
+	config   TokenBucketConfig       // config is the configuration of the created limiters
+	mu       sync.Mutex              // mu protects limiters
+	limiters map[string]*TokenBucket // limiters contains the limiter of each user
+}
+
+// NewUserRateLimiters creates a set of per-user rate limiters
+func NewUserRateLimiters(config TokenBucketConfig) *UserRateLimiters {
+	return &UserRateLimiters{
+		config:   config,
+		limiters: make(map[string]*TokenBucket),
+	}
+}
+
+// ForUser returns the rate limiter of a user, creating it if needed
+func (u *UserRateLimiters) ForUser(user string) RateLimiter {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	limiter, ok := u.limiters[user]
+	if !ok {
+		limiter = NewTokenBucket(u.config)
+		u.limiters[user] = limiter
+	}
+
+	return limiter
+}
+
+// noRateLimiter doesn't limit anything
+type noRateLimiter struct{}
+
+func (noRateLimiter) Wait(ctx context.Context, _ CallKind) error {
+	return ctx.Err()
+}
@@ -0,0 +1,90 @@
+package gdrive
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("burst and rate", func(t *testing.T) {
+		tb := NewTokenBucket(TokenBucketConfig{ReadRate: 20, ReadBurst: 5, WriteRate: 1, WriteBurst: 1})
+		ctx := context.Background()
+
+		start := time.Now()
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, tb.Wait(ctx, CallRead))
+		}
+
+		require.Less(t, int64(time.Since(start)), int64(40*time.Millisecond))
+
+		// The next ones have to wait for new tokens: 5 calls at 20/s
+		for i := 0; i < 5; i++ {
+			require.NoError(t, tb.Wait(ctx, CallRead))
+		}
+
+		require.GreaterOrEqual(t, int64(time.Since(start)), int64(200*time.Millisecond))
+
+		// Reads didn't consume the write budget
+		require.NoError(t, tb.Wait(ctx, CallWrite))
+	})
+
+	t.Run("context", func(t *testing.T) {
+		tb := NewTokenBucket(TokenBucketConfig{ReadRate: 0.01, ReadBurst: 1})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		require.NoError(t, tb.Wait(ctx, CallRead))
+		require.True(t, errors.Is(tb.Wait(ctx, CallRead), context.DeadlineExceeded))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		tb := NewTokenBucket(TokenBucketConfig{})
+
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, tb.Wait(context.Background(), CallWrite))
+		}
+	})
+}
+
+func TestUserRateLimiters(t *testing.T) {
+	limiters := NewUserRateLimiters(DefaultTokenBucketConfig)
+
+	require.Same(t, limiters.ForUser("a@example.com"), limiters.ForUser("a@example.com"))
+	require.NotSame(t, limiters.ForUser("a@example.com"), limiters.ForUser("b@example.com"))
+}
+
+func TestRateLimiting(t *testing.T) {
+	driver := setup(t)
+
+	limiter := &countingRateLimiter{}
+	require.NoError(t, RateLimiting(limiter)(driver))
+
+	mustWriteFile(t, driver, "File1")
+	require.NotZero(t, atomic.LoadInt32(&limiter.reads))
+	require.NotZero(t, atomic.LoadInt32(&limiter.writes))
+
+	require.NoError(t, RateLimiting(nil)(driver))
+	require.NoError(t, getError(driver.Stat("File1")))
+}
+
+type countingRateLimiter struct {
+	reads  int32
+	writes int32
+}
+
+func (l *countingRateLimiter) Wait(_ context.Context, kind CallKind) error {
+	if kind == CallWrite {
+		atomic.AddInt32(&l.writes, 1)
+	} else {
+		atomic.AddInt32(&l.reads, 1)
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package gdrive // nolint: golint
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// maxSeekSkip is the largest forward seek done by discarding the content of the current download, instead of
+// opening a new one
+const maxSeekSkip = 256 << 10
+
+// DefaultReadAheadSize is the size of the ranges prefetched by default
+const DefaultReadAheadSize = 1 << 20
+
+// DefaultParallelRangeSize is the size of the ranges of the parallel downloads by default
+const DefaultParallelRangeSize = 8 << 20
+
+// seeker is implemented by the readers that move without reconnecting
+type seeker interface {
+	seek(offset int64)
+}
+
+// streamReader reads the content of a file with a download, which is only re-opened by the next read after a seek.
+// Once the reads are sequential, the next ranges can be prefetched concurrently (see the ReadAhead option). The
+// large files can also be read from the start with ranges fetched in parallel (see the ParallelDownloads option).
+type streamReader struct {
+	driver       *GDriver
+	fi           *FileInfo
+	offset       int64         // offset is the position of the next read
+	lastEnd      int64         // lastEnd is the position after the last read, to detect the sequential reads
+	stream       io.ReadCloser // stream is the current download, if any
+	streamOffset int64         // streamOffset is the position of the download
+	ahead        []*prefetch   // ahead are the ranges being prefetched, in order
+	aheadDriver  *GDriver      // aheadDriver fetches the ranges, with a context cancelled when they're dropped
+	aheadCancel  func()        // aheadCancel cancels the context of aheadDriver
+	aheadRanges  int           // aheadRanges is the number of ranges fetched concurrently, none if not positive
+	aheadSize    int64         // aheadSize is the size of the ranges
+	parallel     bool          // parallel is set when all the reads use the ranges, instead of the download
+}
+
+// prefetch is a range of a file being fetched in the background
+type prefetch struct {
+	start int64         // start is the offset of the range
+	size  int64         // size is the requested size, the data can be shorter at the end of the file
+	data  []byte        // data is the content of the range, once done
+	err   error         // err is the error of the download, once done
+	done  chan struct{} // done is closed when the download is over
+}
+
+func (d *GDriver) newStreamReader(fi *FileInfo, offset int64) *streamReader {
+	r := &streamReader{
+		driver:  d,
+		fi:      fi,
+		offset:  offset,
+		lastEnd: -1,
+	}
+
+	// The exports are fetched as a whole
+	switch {
+	case fi.export != nil:
+	case d.ParallelDownloadWorkers > 0 && fi.Size() > d.ParallelDownloadThreshold:
+		r.parallel = true
+		r.aheadRanges, r.aheadSize = d.ParallelDownloadWorkers, d.ParallelDownloadRangeSize
+
+		if r.aheadSize <= 0 {
+			r.aheadSize = DefaultParallelRangeSize
+		}
+	default:
+		r.aheadRanges, r.aheadSize = d.ReadAheadRanges, d.ReadAheadSize
+
+		if r.aheadSize <= 0 {
+			r.aheadSize = DefaultReadAheadSize
+		}
+	}
+
+	return r
+}
+
+// seek moves the position of the next read, the download is only changed when reading
+func (r *streamReader) seek(offset int64) {
+	r.offset = offset
+}
+
+// Read reads from the current offset
+func (r *streamReader) Read(p []byte) (int, error) {
+	// The size of the exports is only known once they're exported
+	if r.fi.export == nil && r.offset >= r.fi.Size() {
+		return 0, io.EOF
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	var n int
+
+	var err error
+
+	if r.readAhead() {
+		n, err = r.readPrefetched(p)
+	} else {
+		n, err = r.readStream(p)
+	}
+
+	r.offset += int64(n)
+	r.lastEnd = r.offset
+
+	return n, err
+}
+
+// readStream reads from the download, which is moved forward or re-opened if it isn't at the current offset
+func (r *streamReader) readStream(p []byte) (int, error) {
+	if r.stream != nil && r.streamOffset != r.offset {
+		skip := r.offset - r.streamOffset
+
+		if skip > 0 && skip <= maxSeekSkip {
+			n, err := io.CopyN(ioutil.Discard, r.stream, skip)
+			r.streamOffset += n
+
+			if err != nil {
+				r.closeStream()
+			}
+		} else {
+			r.closeStream()
+		}
+	}
+
+	if r.stream == nil {
+		stream, err := r.driver.getFileReader(r.fi, r.offset)
+		if err != nil {
+			return 0, err
+		}
+
+		r.stream, r.streamOffset = stream, r.offset
+	}
+
+	n, err := r.stream.Read(p)
+	r.streamOffset += int64(n)
+
+	return n, err
+}
+
+// readAhead returns true if the read is served by the prefetched ranges: they are enabled and the reads are
+// sequential. A seek out of the prefetched ranges drops them.
+func (r *streamReader) readAhead() bool {
+	if r.aheadRanges <= 0 {
+		return false
+	}
+
+	if len(r.ahead) > 0 {
+		last := r.ahead[len(r.ahead)-1]
+
+		if r.offset >= r.ahead[0].start && r.offset < last.start+last.size {
+			for r.offset >= r.ahead[0].start+r.ahead[0].size {
+				r.ahead = r.ahead[1:]
+			}
+
+			return true
+		}
+
+		r.dropAhead()
+	}
+
+	return r.parallel || r.offset == r.lastEnd
+}
+
+// readPrefetched reads from the first prefetched range
+func (r *streamReader) readPrefetched(p []byte) (int, error) {
+	// The download isn't needed anymore
+	r.closeStream()
+	r.prefetch()
+
+	pf := r.ahead[0]
+	<-pf.done
+
+	if pf.err != nil {
+		r.dropAhead()
+		return 0, pf.err
+	}
+
+	within := int(r.offset - pf.start)
+	if within >= len(pf.data) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, pf.data[within:])
+
+	if within+n == len(pf.data) {
+		r.ahead = r.ahead[1:]
+	}
+
+	return n, nil
+}
+
+// prefetch starts the downloads of the ranges following the ones already prefetched. As the ranges are only
+// replaced once read, at most aheadRanges of them are in memory.
+func (r *streamReader) prefetch() {
+	next := r.offset
+
+	if len(r.ahead) > 0 {
+		last := r.ahead[len(r.ahead)-1]
+		next = last.start + last.size
+	}
+
+	if r.aheadDriver == nil {
+		ctx, cancel := context.WithCancel(r.driver.Context())
+		r.aheadDriver, r.aheadCancel = r.driver.WithContext(ctx), cancel
+	}
+
+	for len(r.ahead) < r.aheadRanges && (len(r.ahead) == 0 || next < r.fi.Size()) {
+		pf := &prefetch{start: next, size: r.aheadSize, done: make(chan struct{})}
+		r.ahead = append(r.ahead, pf)
+		next += r.aheadSize
+
+		driver := r.aheadDriver
+
+		go func() {
+			defer close(pf.done)
+
+			data := make([]byte, pf.size)
+			n, err := driver.fetchRange(r.fi, data, pf.start)
+
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			pf.data, pf.err = data[:n], err
+		}()
+	}
+}
+
+// fetchRange reads a range of a file. Like the other API calls, the request is retried if it fails, and the range is
+// also fetched again when its download is interrupted.
+func (d *GDriver) fetchRange(fi *FileInfo, p []byte, off int64) (int, error) {
+	ctx := d.Context()
+	policy := d.retryPolicy
+
+	for failures := 1; ; failures++ {
+		n, err := d.readFileAt(fi, p, off)
+
+		var streamErr *DriveStreamError
+		if !errors.As(err, &streamErr) || failures >= policy.MaxAttempts {
+			return n, err
+		}
+
+		d.Logger.Warn("Range download interrupted", "fileId", fi.file.Id, "offset", off, "err", err)
+
+		if sleepContext(ctx, policy.delay(failures, err)) != nil {
+			return n, err
+		}
+	}
+}
+
+// dropAhead drops the prefetched ranges, the downloads of the ones that aren't done yet are cancelled
+func (r *streamReader) dropAhead() {
+	r.ahead = nil
+
+	if r.aheadCancel != nil {
+		r.aheadCancel()
+		r.aheadDriver, r.aheadCancel = nil, nil
+	}
+}
+
+func (r *streamReader) closeStream() {
+	if r.stream != nil {
+		_ = r.stream.Close()
+		r.stream = nil
+	}
+}
+
+// Close closes the download, the prefetched ranges are dropped
+func (r *streamReader) Close() error {
+	r.dropAhead()
+
+	if r.stream == nil {
+		return nil
+	}
+
+	err := r.stream.Close()
+	r.stream = nil
+
+	return err
+}
@@ -0,0 +1,292 @@
+package gdrive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazySeek(t *testing.T) {
+	driver := setup(t)
+	counter := countDownloads(driver)
+
+	content := make([]byte, 2*maxSeekSkip)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(driver, "File1", bytes.NewReader(content)))
+
+	f, err := driver.Open("File1")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, f.Close()) }()
+
+	require.EqualValues(t, 1, counter.count())
+
+	buffer := make([]byte, 10)
+
+	// The seeks don't download anything by themselves
+	for _, offset := range []int64{1000, 50, 3000} {
+		_, err = f.Seek(offset, io.SeekStart)
+		require.NoError(t, err)
+	}
+
+	require.EqualValues(t, 1, counter.count())
+
+	// A small forward seek continues the download
+	_, err = io.ReadFull(f, buffer)
+	require.NoError(t, err)
+	require.Equal(t, content[3000:3010], buffer)
+
+	_, err = f.Seek(100, io.SeekCurrent)
+	require.NoError(t, err)
+	_, err = io.ReadFull(f, buffer)
+	require.NoError(t, err)
+	require.Equal(t, content[3110:3120], buffer)
+	require.EqualValues(t, 1, counter.count())
+
+	// Seeking backward, or far away, opens a new one
+	offset, err := f.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	require.EqualValues(t, len(content)-10, offset)
+
+	rest, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, content[len(content)-10:], rest)
+	require.EqualValues(t, 2, counter.count())
+
+	_, err = f.Seek(-1, io.SeekStart)
+	require.Equal(t, ErrInvalidSeek, err)
+}
+
+func TestReadAhead(t *testing.T) {
+	driver := setup(t, ReadAhead(3, 1000))
+	counter := countDownloads(driver)
+
+	content := make([]byte, 10500)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(driver, "File1", bytes.NewReader(content)))
+
+	f, err := driver.Open("File1")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, f.Close()) }()
+
+	// The first read uses the download, and the next ones the 10 following ranges
+	buffer := make([]byte, 500)
+	_, err = io.ReadFull(f, buffer)
+	require.NoError(t, err)
+	require.Equal(t, content[:500], buffer)
+
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, content[500:], data)
+	require.EqualValues(t, 11, counter.count())
+
+	// A seek out of the prefetched ranges starts with a download again
+	_, err = f.Seek(5200, io.SeekStart)
+	require.NoError(t, err)
+
+	buffer = make([]byte, 300)
+	_, err = io.ReadFull(f, buffer)
+	require.NoError(t, err)
+	require.Equal(t, content[5200:5500], buffer)
+	require.EqualValues(t, 12, counter.count())
+
+	_, err = io.ReadFull(f, buffer)
+	require.NoError(t, err)
+	require.Equal(t, content[5500:5800], buffer)
+}
+
+// stallingTransport holds the ranged downloads of the ranges starting between two offsets until they're cancelled
+type stallingTransport struct {
+	base      http.RoundTripper
+	from, to  int64
+	requests  int32
+	cancelled int32
+}
+
+func (t *stallingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+
+	var start, end int64
+	if _, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil ||
+		start < t.from || start >= t.to {
+		return t.base.RoundTrip(req)
+	}
+
+	<-req.Context().Done()
+	atomic.AddInt32(&t.cancelled, 1)
+
+	return nil, req.Context().Err()
+}
+
+func TestPrefetchCancel(t *testing.T) {
+	content := make([]byte, 10500)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	// open reads the first 1000 bytes of a file, the 2 ranges prefetched after the first one stall
+	open := func(t *testing.T, option Option) (*stallingTransport, afero.File) {
+		driver := setup(t, option)
+		stalling := &stallingTransport{base: driver.client.Transport, from: 1000, to: 3000}
+		driver.client.Transport = stalling
+
+		require.NoError(t, writeFile(driver, "File1", bytes.NewReader(content)))
+
+		f, err := driver.Open("File1")
+		require.NoError(t, err)
+
+		buffer := make([]byte, 500)
+
+		for i := 0; i < 2; i++ {
+			_, err = io.ReadFull(f, buffer)
+			require.NoError(t, err)
+			require.Equal(t, content[i*500:(i+1)*500], buffer)
+		}
+
+		return stalling, f
+	}
+
+	// cancelled waits for the 2 stalled ranges to be cancelled
+	cancelled := func(t *testing.T, stalling *stallingTransport) {
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt32(&stalling.cancelled) == 2
+		}, time.Second, time.Millisecond)
+	}
+
+	for name, option := range map[string]Option{
+		"read ahead": ReadAhead(3, 1000),
+		"parallel":   ParallelDownloads(1000, 3, 1000),
+	} {
+		option := option
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("close", func(t *testing.T) {
+				stalling, f := open(t, option)
+				require.NoError(t, f.Close())
+				cancelled(t, stalling)
+
+				// The cancelled ranges aren't requested again
+				requests := atomic.LoadInt32(&stalling.requests)
+				time.Sleep(50 * time.Millisecond)
+				require.Equal(t, requests, atomic.LoadInt32(&stalling.requests))
+			})
+
+			t.Run("seek", func(t *testing.T) {
+				stalling, f := open(t, option)
+
+				defer func() { require.NoError(t, f.Close()) }()
+
+				_, err := f.Seek(5200, io.SeekStart)
+				require.NoError(t, err)
+
+				buffer := make([]byte, 300)
+				_, err = io.ReadFull(f, buffer)
+				require.NoError(t, err)
+				require.Equal(t, content[5200:5500], buffer)
+				cancelled(t, stalling)
+			})
+		})
+	}
+}
+
+// truncatingTransport cuts the first ranged download short
+type truncatingTransport struct {
+	base      http.RoundTripper
+	truncated int32
+}
+
+func (t *truncatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || req.Header.Get("Range") == "" || !atomic.CompareAndSwapInt32(&t.truncated, 0, 1) {
+		return resp, err
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, 10), resp.Body}
+
+	return resp, nil
+}
+
+func TestReadAtShortDownload(t *testing.T) {
+	driver := setup(t)
+	counter := countDownloads(driver)
+	truncating := &truncatingTransport{base: counter}
+	driver.client.Transport = truncating
+
+	content := make([]byte, 1000)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(driver, "File1", bytes.NewReader(content)))
+
+	f, err := driver.Open("File1")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, f.Close()) }()
+
+	// The download cut short isn't the end of the file, the rest of the range is requested again
+	buffer := make([]byte, 100)
+	n, err := f.ReadAt(buffer, 50)
+	require.NoError(t, err)
+	require.Equal(t, 100, n)
+	require.Equal(t, content[50:150], buffer)
+	require.EqualValues(t, 1, atomic.LoadInt32(&truncating.truncated))
+	require.EqualValues(t, 3, counter.count())
+
+	n, err = f.ReadAt(buffer, 950)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 50, n)
+	require.Equal(t, content[950:], buffer[:n])
+}
+
+func TestParallelDownloads(t *testing.T) {
+	driver := setup(t, ParallelDownloads(1000, 4, 1000),
+		Retry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	counter := countDownloads(driver)
+	truncating := &truncatingTransport{base: counter}
+	driver.client.Transport = truncating
+
+	small := []byte("Hello World")
+	require.NoError(t, writeFile(driver, "Small", bytes.NewReader(small)))
+
+	large := make([]byte, 10500)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(driver, "Large", bytes.NewReader(large)))
+
+	// The small files are still read with a single download
+	mustReadFileContent(t, driver, "Small", string(small))
+	require.EqualValues(t, 1, counter.count())
+
+	f, err := driver.Open("Large")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, f.Close()) }()
+
+	// The 11 ranges, and the one that was interrupted
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, large, data)
+	require.EqualValues(t, 1, atomic.LoadInt32(&truncating.truncated))
+	require.EqualValues(t, 13, counter.count())
+
+	// Seeking restarts the downloads from the new offset
+	_, err = f.Seek(-600, io.SeekEnd)
+	require.NoError(t, err)
+
+	data, err = ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, large[len(large)-600:], data)
+}
@@ -0,0 +1,369 @@
+package gdrive // nolint: golint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// uploadChunkAlignment is the size chunks must be a multiple of, as required by Google Drive
+const uploadChunkAlignment = 256 * 1024
+
+// statusResumeIncomplete is returned by Google Drive while a resumable upload isn't complete
+const statusResumeIncomplete = http.StatusPermanentRedirect
+
+// UploadSession is a resumable upload session. It can be persisted to resume an upload after a restart.
+type UploadSession struct {
+	URI    string `json:"uri"`    // URI is the session URI given by Google Drive
+	FileID string `json:"fileId"` // FileID is the ID of the uploaded file
+	Offset int64  `json:"offset"` // Offset is the number of bytes Google Drive acknowledged
+}
+
+// resumableWriter uploads a file by chunks using the resumable upload protocol. The data is kept until Google Drive
+// acknowledges it, so that it can be sent again if the connection drops.
+type resumableWriter struct {
+	driver     *GDriver       // driver is the driver that started the upload
+	fi         *FileInfo      // fi is the uploaded file, it's updated once the upload is complete
+	path       string         // path is the path of the file, it's passed to the progress callback
+	session    *UploadSession // session is the upload session
+	chunk      []byte         // chunk contains the data that might not have been acknowledged yet
+	chunkStart int64          // chunkStart is the offset of the first byte of chunk
+	chunkSize  int            // chunkSize is the size of the chunks to send
+	done       bool           // done is set once the upload is complete
+}
+
+// uploadChunkSize returns the configured chunk size, rounded to a valid chunk size
+func (d *GDriver) uploadChunkSize() int {
+	size := (d.UploadChunkSize + uploadChunkAlignment - 1) / uploadChunkAlignment * uploadChunkAlignment
+	if size < uploadChunkAlignment {
+		size = uploadChunkAlignment
+	}
+
+	return size
+}
+
+// openFileResumable opens a file for writing with a resumable upload
+func (d *GDriver) openFileResumable(fi *FileInfo, path string) (afero.File, error) {
+	session, err := d.startUploadSession(fi.file.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.newResumableFile(fi, path, session), nil
+}
+
+// ResumeUpload resumes an upload that was interrupted, like by a restart of the process. Google Drive is asked how
+// much of the file it received, the session Offset is updated accordingly and the content has to be written to
+// the returned file from this offset.
+func (d *GDriver) ResumeUpload(path string, session *UploadSession) (afero.File, error) {
+	fi, err := d.getFile(path, listFields...)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.file.Id != session.FileID {
+		return nil, ErrInvalidUploadSession
+	}
+
+	f := d.newResumableFile(fi, path, session)
+
+	file, err := d.sendUploadChunk(session, nil, -1)
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	f.upload.chunkStart = session.Offset
+	f.streamOffset = session.Offset
+
+	if file != nil {
+		f.upload.complete(file)
+	}
+
+	return f, nil
+}
+
+func (d *GDriver) newResumableFile(fi *FileInfo, path string, session *UploadSession) *File {
+	writer := &resumableWriter{
+		driver:     d,
+		fi:         fi,
+		path:       path,
+		session:    session,
+		chunkStart: session.Offset,
+		chunkSize:  d.uploadChunkSize(),
+	}
+
+	return &File{
+		driver:       d,
+		Path:         path,
+		FileInfo:     fi,
+		streamWrite:  writer,
+		streamOffset: session.Offset,
+		upload:       writer,
+	}
+}
+
+// uploadBasePath returns the base path of the upload API
+func (d *GDriver) uploadBasePath() string {
+	return strings.Replace(d.srv.BasePath, "/drive/v3/", "/upload/drive/v3/", 1)
+}
+
+// startUploadSession starts a resumable upload session to update the content of a file
+func (d *GDriver) startUploadSession(fileID string) (*UploadSession, error) {
+	query := url.Values{}
+	query.Set("uploadType", "resumable")
+	query.Set("supportsAllDrives", "true")
+	query.Set("fields", googleapi.CombineFields(fileInfoFields))
+	query.Set("alt", "json")
+
+	urls := googleapi.ResolveRelative(d.uploadBasePath(), "files/"+url.PathEscape(fileID)) + "?" + query.Encode()
+
+	var session *UploadSession
+
+	err := d.callAPI(CallWrite, true, func() error {
+		request, err := http.NewRequest(http.MethodPatch, urls, strings.NewReader("{}"))
+		if err != nil {
+			return err
+		}
+
+		request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+		response, err := d.client.Do(request.WithContext(d.Context()))
+		if err != nil {
+			return err
+		}
+
+		defer googleapi.CloseBody(response)
+
+		if err := googleapi.CheckResponse(response); err != nil {
+			return err
+		}
+
+		location := response.Header.Get("Location")
+		if location == "" {
+			return ErrInvalidUploadSession
+		}
+
+		session = &UploadSession{URI: location, FileID: fileID}
+
+		return nil
+	})
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	return session, nil
+}
+
+// sendUploadChunk sends some data at the offset of the session. The total size is passed with the last chunk, or
+// is negative if unknown. Sending no data allows to fetch the status of the session. The offset of the session
+// is updated with what Google Drive received, and the file is returned once the upload is complete.
+func (d *GDriver) sendUploadChunk(session *UploadSession, data []byte, total int64) (*drive.File, error) {
+	request, err := http.NewRequest(http.MethodPut, session.URI, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	totalStr := "*"
+	if total >= 0 {
+		totalStr = strconv.FormatInt(total, 10)
+	}
+
+	if len(data) > 0 {
+		request.Header.Set("Content-Range", fmt.Sprintf(
+			"bytes %d-%d/%s", session.Offset, session.Offset+int64(len(data))-1, totalStr,
+		))
+	} else {
+		request.Header.Set("Content-Range", "bytes */"+totalStr)
+	}
+
+	if err := d.rateLimit(CallWrite); err != nil {
+		return nil, err
+	}
+
+	response, err := d.client.Do(request.WithContext(d.Context()))
+	if err != nil {
+		return nil, err
+	}
+
+	defer googleapi.CloseBody(response)
+
+	switch response.StatusCode {
+	case statusResumeIncomplete:
+		session.Offset = parseUploadRange(response.Header.Get("Range"))
+		return nil, nil
+	case http.StatusNotFound, http.StatusGone:
+		return nil, ErrUploadSessionExpired
+	}
+
+	if err := googleapi.CheckResponse(response); err != nil {
+		return nil, err
+	}
+
+	file := &drive.File{}
+	if err := json.NewDecoder(response.Body).Decode(file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// parseUploadRange parses the "bytes=0-N" range returned by Google Drive, and returns the number of bytes received
+func parseUploadRange(header string) int64 {
+	bounds := strings.SplitN(strings.TrimPrefix(header, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0
+	}
+
+	last, err := strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return last + 1
+}
+
+// resumableError returns true if an upload can be resumed after this error
+func resumableError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		// Network errors
+		return !errors.Is(err, ErrUploadSessionExpired)
+	}
+
+	return retryable(err, true)
+}
+
+func (w *resumableWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, afero.ErrFileClosed
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		n := w.chunkSize - len(w.chunk)
+		if n > len(p) {
+			n = len(p)
+		}
+
+		w.chunk = append(w.chunk, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(w.chunk) >= w.chunkSize {
+			if err := w.send(false); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Close sends the last chunk and completes the upload
+func (w *resumableWriter) Close() error {
+	if w.done {
+		return nil
+	}
+
+	if err := w.send(true); err != nil {
+		return &DriveAPICallError{Err: err}
+	}
+
+	return nil
+}
+
+// send sends the buffered data: all of it for the last chunk, or its aligned part otherwise. When the connection
+// fails, the status of the session is fetched and the data that wasn't received is sent again.
+func (w *resumableWriter) send(final bool) error {
+	ctx := w.driver.Context()
+	policy := w.driver.retryPolicy
+	failures := 0
+	query := false
+
+	for {
+		if w.session.Offset < w.chunkStart {
+			return ErrUploadIncomplete
+		}
+
+		// We drop what was acknowledged
+		w.chunk = w.chunk[w.session.Offset-w.chunkStart:]
+		w.chunkStart = w.session.Offset
+
+		data := w.chunk
+		total := int64(-1)
+
+		if final {
+			total = w.chunkStart + int64(len(data))
+		} else {
+			data = data[:len(data)/uploadChunkAlignment*uploadChunkAlignment]
+		}
+
+		if query {
+			data = nil
+		} else if len(data) == 0 && !final {
+			return nil
+		}
+
+		previousOffset := w.session.Offset
+
+		file, err := w.driver.sendUploadChunk(w.session, data, total)
+		if err == nil && file != nil {
+			w.complete(file)
+			return nil
+		}
+
+		if err == nil && (query || w.session.Offset > previousOffset) {
+			query = false
+
+			w.progress()
+
+			continue
+		}
+
+		if err == nil {
+			err = ErrUploadIncomplete
+		}
+
+		failures++
+
+		if ctx.Err() != nil || failures >= policy.MaxAttempts || !resumableError(err) {
+			return err
+		}
+
+		if err := sleepContext(ctx, policy.delay(failures, err)); err != nil {
+			return err
+		}
+
+		// We don't know what was received, we'll ask before sending anything
+		query = true
+	}
+}
+
+// complete marks the upload as complete
+func (w *resumableWriter) complete(file *drive.File) {
+	w.session.Offset = file.Size
+	w.chunk = nil
+	w.chunkStart = file.Size
+	w.done = true
+	w.driver.srvWrapper.fileUpdated(file, w.fi.file.Parents)
+	w.fi.file = file
+
+	w.progress()
+}
+
+// progress reports the progress of the upload
+func (w *resumableWriter) progress() {
+	if w.driver.UploadProgress != nil {
+		w.driver.UploadProgress(w.path, *w.session)
+	}
+}
@@ -0,0 +1,111 @@
+package gdrive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jonny5532/afero-gdrive/drivetest"
+)
+
+// resumableOptions make the drivers upload the files in chunks, and keep their upload sessions
+func resumableOptions(sessions *[]UploadSession) []Option {
+	return []Option{
+		ResumableUploads(1, func(_ string, session UploadSession) {
+			*sessions = append(*sessions, session)
+		}),
+		Retry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}),
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	var sessions []UploadSession
+
+	driver, server := setupFake(t, resumableOptions(&sessions)...)
+
+	content := make([]byte, uploadChunkAlignment*2+1000)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	t.Run("chunks", func(t *testing.T) {
+		sessions = nil
+
+		require.NoError(t, writeFile(driver, "File1", bytes.NewReader(content)))
+		require.Len(t, sessions, 3)
+		require.EqualValues(t, uploadChunkAlignment, sessions[0].Offset)
+		require.EqualValues(t, len(content), sessions[2].Offset)
+
+		mustReadFileContent(t, driver, "File1", string(content))
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		require.NoError(t, writeFile(driver, "File2", bytes.NewReader(nil)))
+
+		fi, err := driver.Stat("File2")
+		require.NoError(t, err)
+		require.Zero(t, fi.Size())
+	})
+
+	t.Run("interrupted chunks", func(t *testing.T) {
+		server.Fail(
+			drivetest.Failure{Code: http.StatusServiceUnavailable, Reason: "backendError", Method: http.MethodPut},
+			drivetest.Failure{Code: http.StatusInternalServerError, Reason: "backendError", Method: http.MethodPut},
+		)
+
+		f, err := driver.OpenFile("File1", os.O_WRONLY, os.FileMode(0))
+		require.NoError(t, err)
+
+		_, err = f.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.Zero(t, server.PendingFailures())
+
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), fi.Size())
+
+		mustReadFileContent(t, driver, "File1", string(content))
+	})
+
+	t.Run("resume after restart", func(t *testing.T) {
+		f, err := driver.OpenFile("File1", os.O_WRONLY, os.FileMode(0))
+		require.NoError(t, err)
+
+		_, err = f.Write(content[:uploadChunkAlignment+100])
+		require.NoError(t, err)
+
+		// The process "crashes", only the persisted session remains
+		session := *f.(*File).UploadSession()
+		require.EqualValues(t, uploadChunkAlignment, session.Offset)
+
+		other := reopen(t, server, driver, resumableOptions(&sessions)...)
+
+		resumed, err := other.ResumeUpload("File1", &session)
+		require.NoError(t, err)
+		require.EqualValues(t, uploadChunkAlignment, session.Offset)
+
+		_, err = resumed.Write(content[session.Offset:])
+		require.NoError(t, err)
+		require.NoError(t, resumed.Close())
+
+		mustReadFileContent(t, driver, "File1", string(content))
+
+		_, err = other.ResumeUpload("File1", &session)
+		require.Error(t, err)
+		require.ErrorIs(t, err, ErrUploadSessionExpired)
+
+		_, err = other.ResumeUpload("File2", &session)
+		require.Equal(t, ErrInvalidUploadSession, err)
+	})
+}
+
+func TestParseUploadRange(t *testing.T) {
+	require.EqualValues(t, 0, parseUploadRange(""))
+	require.EqualValues(t, 100, parseUploadRange("bytes=0-99"))
+	require.EqualValues(t, 0, parseUploadRange("bytes=0-x"))
+}
@@ -0,0 +1,172 @@
+package gdrive // nolint: golint
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// RetryPolicy defines how the API calls that failed with a transient error (rate limit exceeded, backend error)
+// are retried. The delay between two attempts grows exponentially and is randomized. The delays left to zero are the
+// ones of DefaultRetryPolicy, and MaxDelay is raised to BaseDelay if it's lower.
+type RetryPolicy struct {
+	MaxAttempts int           // MaxAttempts is the maximum number of attempts, including the first one
+	BaseDelay   time.Duration // BaseDelay is the delay before the first retry
+	MaxDelay    time.Duration // MaxDelay caps the delay between two attempts, unless the server asks for more
+}
+
+// DefaultRetryPolicy is the retry policy used by default
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// rateLimitReasons are the error reasons returned by Google Drive when a quota is exceeded
+var rateLimitReasons = map[string]bool{
+	"userRateLimitExceeded": true,
+	"rateLimitExceeded":     true,
+}
+
+// isRateLimitError returns true if the call was rejected because of a quota, it can then be retried safely
+func isRateLimitError(apiErr *googleapi.Error) bool {
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+
+	for _, item := range apiErr.Errors {
+		if rateLimitReasons[item.Reason] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTransientError returns true if the call failed because of a temporary server side issue
+func isTransientError(apiErr *googleapi.Error) bool {
+	if apiErr.Code >= http.StatusInternalServerError {
+		return true
+	}
+
+	for _, item := range apiErr.Errors {
+		if item.Reason == "backendError" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryable returns true if the error can be retried. Calls that are not idempotent (like creations) are only
+// retried when we're sure they were rejected, and not when the server failed in the middle of them.
+func retryable(err error, idempotent bool) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return isRateLimitError(apiErr) || idempotent && isTransientError(apiErr)
+}
+
+// retryAfter returns the delay requested by the server, if any
+func retryAfter(err error) time.Duration {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Header == nil {
+		return 0
+	}
+
+	value := apiErr.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, errParse := strconv.Atoi(value); errParse == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, errParse := http.ParseTime(value); errParse == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// delay returns the delay to wait before the given retry (starting at 1)
+func (p *RetryPolicy) delay(retry int, err error) time.Duration {
+	baseDelay, maxDelay := p.BaseDelay, p.MaxDelay
+
+	if baseDelay <= 0 {
+		baseDelay = DefaultRetryPolicy.BaseDelay
+	}
+
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryPolicy.MaxDelay
+	}
+
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+
+	delay := maxDelay
+
+	// The delay is only doubled while it stays below the maximum, so that it can't overflow
+	if shift := uint(retry - 1); shift < 63 && baseDelay <= maxDelay>>shift {
+		delay = baseDelay << shift
+	}
+
+	// We wait between half and all of the computed delay so that concurrent clients don't retry together
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half)) // nolint: gosec
+	}
+
+	if requested := retryAfter(err); requested > delay {
+		delay = requested
+	}
+
+	return delay
+}
+
+// callAPI performs an API call. Each attempt is rate limited and the failed attempts are retried according to
+// the policy.
+func callAPI(
+	ctx context.Context,
+	limiter RateLimiter,
+	policy *RetryPolicy,
+	kind CallKind,
+	idempotent bool,
+	call func() error,
+) error {
+	for attempt := 1; ; attempt++ {
+		if err := limiter.Wait(ctx, kind); err != nil {
+			return err
+		}
+
+		err := call()
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err, idempotent) {
+			return err
+		}
+
+		if sleepContext(ctx, policy.delay(attempt, err)) != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for the given delay, or until the context is done
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
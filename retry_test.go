@@ -0,0 +1,115 @@
+package gdrive
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+
+	"github.com/jonny5532/afero-gdrive/drivetest"
+)
+
+func TestRetryable(t *testing.T) {
+	rateLimited := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}},
+	}
+	backendError := &googleapi.Error{Code: http.StatusInternalServerError}
+	notFound := &googleapi.Error{Code: http.StatusNotFound}
+
+	require.True(t, retryable(rateLimited, false))
+	require.True(t, retryable(&DriveAPICallError{Err: rateLimited}, true))
+	require.True(t, retryable(&googleapi.Error{Code: http.StatusTooManyRequests}, false))
+	require.True(t, retryable(backendError, true))
+	require.False(t, retryable(backendError, false))
+	require.False(t, retryable(notFound, true))
+	require.False(t, retryable(errors.New("other"), true))
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for retry, limit := range map[int]time.Duration{1: 100, 2: 200, 3: 400, 5: 1000, 100: 1000} {
+		limit *= time.Millisecond
+		delay := policy.delay(retry, nil)
+		require.True(t, delay >= limit/2 && delay <= limit, "retry %d: %s", retry, delay)
+	}
+
+	withHeader := &googleapi.Error{Code: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"3"}}}
+	require.Equal(t, 3*time.Second, policy.delay(1, withHeader))
+
+	// The delays of a policy built without them are the default ones
+	policy = &RetryPolicy{MaxAttempts: 3}
+	delay := policy.delay(1, nil)
+	require.True(t, delay >= DefaultRetryPolicy.BaseDelay/2 && delay <= DefaultRetryPolicy.BaseDelay, delay)
+
+	delay = (&RetryPolicy{}).delay(30, nil)
+	require.True(t, delay >= DefaultRetryPolicy.MaxDelay/2 && delay <= DefaultRetryPolicy.MaxDelay, delay)
+
+	// The maximum delay is at least the base one, and the delay doesn't overflow after many retries
+	policy = &RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Second}
+	for _, retry := range []int{1, 40, 64, 1000} {
+		delay := policy.delay(retry, nil)
+		require.True(t, delay >= time.Hour/2 && delay <= time.Hour, "retry %d: %s", retry, delay)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	driver, server := setupFake(t, Retry(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}))
+
+	t.Run("transient errors", func(t *testing.T) {
+		server.Fail(
+			drivetest.Failure{Code: http.StatusForbidden, Reason: "userRateLimitExceeded"},
+			drivetest.Failure{Code: http.StatusInternalServerError, Reason: "backendError"},
+		)
+
+		require.NoError(t, driver.MkdirAll("Folder1", 0))
+		require.Zero(t, server.PendingFailures())
+	})
+
+	t.Run("too many errors", func(t *testing.T) {
+		server.Fail(
+			drivetest.Failure{Code: http.StatusServiceUnavailable, Reason: "backendError"},
+			drivetest.Failure{Code: http.StatusServiceUnavailable, Reason: "backendError"},
+			drivetest.Failure{Code: http.StatusServiceUnavailable, Reason: "backendError"},
+		)
+
+		// The listing of Folder1 isn't cached yet
+		_, err := driver.Stat("Folder1/File1")
+		require.Error(t, err)
+		require.Zero(t, server.PendingFailures())
+	})
+
+	t.Run("creations aren't duplicated", func(t *testing.T) {
+		require.NoError(t, driver.MkdirAll("Folder2", 0))
+
+		server.Fail(
+			drivetest.Failure{Code: http.StatusInternalServerError, Reason: "backendError", Method: http.MethodPost},
+			drivetest.Failure{Code: http.StatusInternalServerError, Reason: "backendError", Method: http.MethodPost},
+		)
+
+		_, err := driver.createFile("Folder2/File1")
+		require.Error(t, err)
+		require.Equal(t, 1, server.PendingFailures())
+
+		_, err = driver.createFile("Folder2/File1")
+		require.Error(t, err)
+		require.Zero(t, server.PendingFailures())
+	})
+
+	t.Run("non-transient errors", func(t *testing.T) {
+		server.Fail(drivetest.Failure{Code: http.StatusBadRequest, Reason: "badRequest"})
+
+		_, err := driver.Stat("Folder1/File1")
+		require.Error(t, err)
+		require.Zero(t, server.PendingFailures())
+		require.NoError(t, getError(driver.Stat("Folder1")))
+	})
+}
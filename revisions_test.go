@@ -0,0 +1,113 @@
+package gdrive
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jonny5532/afero-gdrive/drivetest"
+)
+
+func TestRevisions(t *testing.T) {
+	// The revisions a real drive keeps and their users depend on the account
+	driver, server := setupFake(t, Retry(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}))
+
+	mustWriteFileContent(t, driver, "config.ini", "version=1")
+	mustWriteFileContent(t, driver, "config.ini", "version=2, overwritten")
+
+	revisions, err := driver.ListRevisions("config.ini")
+	require.NoError(t, err)
+
+	// The file is created empty before its content is uploaded
+	require.Len(t, revisions, 3)
+	require.EqualValues(t, 0, revisions[0].Size)
+
+	first, head := revisions[1], revisions[2]
+	require.EqualValues(t, 9, first.Size)
+	require.NotEmpty(t, first.MD5Checksum)
+	require.False(t, first.ModifiedTime.IsZero())
+	require.Equal(t, drivetest.User.EmailAddress, first.LastModifyingUser.EmailAddress)
+
+	t.Run("open", func(t *testing.T) {
+		f, err := driver.OpenRevision("config.ini", first.ID)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, f.Close()) }()
+
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		require.Equal(t, "config.ini", fi.Name())
+		require.EqualValues(t, 9, fi.Size())
+
+		data, err := ioutil.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "version=1", string(data))
+
+		// The revision is read with ranged downloads too
+		buf := make([]byte, 1)
+		_, err = f.ReadAt(buf, 8)
+		require.NoError(t, err)
+		require.Equal(t, "1", string(buf))
+
+		_, err = f.Seek(-1, io.SeekEnd)
+		require.NoError(t, err)
+		data, err = ioutil.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "1", string(data))
+
+		_, err = f.Write([]byte("version=3"))
+		require.Equal(t, ErrReadOnly, err)
+		require.Equal(t, ErrReadOnly, f.Truncate(0))
+
+		mustReadFileContent(t, driver, "config.ini", "version=2, overwritten")
+	})
+
+	t.Run("pin", func(t *testing.T) {
+		pinned, err := driver.PinRevision("config.ini", first.ID, true)
+		require.NoError(t, err)
+		require.True(t, pinned.KeepForever)
+
+		unpinned, err := driver.PinRevision("config.ini", first.ID, false)
+		require.NoError(t, err)
+		require.False(t, unpinned.KeepForever)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.Error(t, driver.DeleteRevision("config.ini", head.ID))
+
+		// The deletion could have been done before failing, it isn't retried
+		server.Fail(drivetest.Failure{
+			Code:   http.StatusInternalServerError,
+			Reason: "backendError",
+			Method: http.MethodDelete,
+		})
+		require.Error(t, driver.DeleteRevision("config.ini", first.ID))
+		require.Zero(t, server.PendingFailures())
+
+		require.NoError(t, driver.DeleteRevision("config.ini", first.ID))
+
+		revisions, err := driver.ListRevisions("config.ini")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		require.Equal(t, head.ID, revisions[1].ID)
+
+		_, err = driver.OpenRevision("config.ini", first.ID)
+		require.Error(t, err)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		require.NoError(t, driver.Mkdir("Folder", os.FileMode(0700)))
+
+		_, err := driver.ListRevisions("Folder")
+		require.Equal(t, FileIsDirectoryError{Path: "Folder"}, err)
+	})
+}
@@ -0,0 +1,111 @@
+package gdrive // nolint: golint
+
+import (
+	"os"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// virtualRootID is the ID of the virtual root that contains My Drive and the shared drives
+const virtualRootID = "virtual-root"
+
+// drivesListPageSize is the maximum page size allowed by Drives.List
+const drivesListPageSize = 100
+
+// virtualRoot returns the virtual root that contains My Drive and the shared drives
+func virtualRoot() *FileInfo {
+	return &FileInfo{
+		file: &drive.File{
+			Id:       virtualRootID,
+			MimeType: mimeTypeFolder,
+		},
+	}
+}
+
+// isVirtual returns true for the virtual root that contains My Drive and the shared drives
+func (i *FileInfo) isVirtual() bool {
+	return i.file.Id == virtualRootID
+}
+
+// isRoot returns true for the root node, and for the drives when the root node is the virtual root
+func (d *GDriver) isRoot(fi *FileInfo) bool {
+	return fi == d.rootNode || d.rootNode.isVirtual() && fi.parentPath == ""
+}
+
+// inDrive restricts a listing to a shared drive, Google Drive requires it to list the files of a shared drive
+func inDrive(call *drive.FilesListCall, driveID string) *drive.FilesListCall {
+	if driveID == "" {
+		return call
+	}
+
+	return call.Corpora("drive").DriveId(driveID)
+}
+
+// getFileByFolderAndName looks for the files of a folder by their name, the folder can be the virtual root
+func (d *GDriver) getFileByFolderAndName(
+	folder *drive.File,
+	fileName string,
+	fields ...googleapi.Field,
+) (*drive.FileList, error) {
+	if folder.Id != virtualRootID {
+		return d.srvWrapper.getFileByFolderAndName(folder, fileName, fields...)
+	}
+
+	roots, err := d.srvWrapper.getDriveRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	list := &drive.FileList{}
+
+	for _, root := range roots {
+		if strings.EqualFold(sanitizeName(root.Name), sanitizeName(fileName)) {
+			list.Files = append(list.Files, root)
+		}
+	}
+
+	return list, nil
+}
+
+// virtualRootEntries returns My Drive and the shared drives
+func (d *GDriver) virtualRootEntries() ([]*FileInfo, error) {
+	roots, err := d.srvWrapper.getDriveRoots()
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	files := make([]*FileInfo, 0, len(roots))
+	for _, root := range roots {
+		files = append(files, d.newFileInfo(root, ""))
+	}
+
+	return files, nil
+}
+
+// listVirtualRoot lists the drives of the virtual root, count at a time if count is positive. Like with the other
+// directories, the next call starts again once they were all listed.
+func (d *GDriver) listVirtualRoot(f *File, count int) ([]os.FileInfo, error) {
+	if f.dirEntries == nil {
+		roots, err := d.virtualRootEntries()
+		if err != nil {
+			return nil, err
+		}
+
+		f.dirEntries = roots
+	}
+
+	files := make([]os.FileInfo, 0)
+
+	for len(f.dirEntries) > 0 && (count <= 0 || len(files) < count) {
+		files = append(files, f.dirEntries[0])
+		f.dirEntries = f.dirEntries[1:]
+	}
+
+	if len(f.dirEntries) == 0 {
+		f.dirEntries = nil
+	}
+
+	return files, nil
+}
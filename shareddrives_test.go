@@ -0,0 +1,96 @@
+package gdrive
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+)
+
+func TestSharedDrives(t *testing.T) {
+	driver, server := setupFake(t, SharedDrives())
+
+	_, err := driver.srv.Drives.Create("request1", &drive.Drive{Name: "Team"}).Do()
+	require.NoError(t, err)
+
+	listNames := func(t *testing.T, path string) []string {
+		dir, err := driver.Open(path)
+		require.NoError(t, err)
+
+		names, err := dir.Readdirnames(-1)
+		require.NoError(t, err)
+
+		return names
+	}
+
+	t.Run("virtual root", func(t *testing.T) {
+		require.Equal(t, []string{"My Drive", "Team"}, listNames(t, "/"))
+
+		// The drives can be listed a few at a time
+		dir, err := driver.Open("/")
+		require.NoError(t, err)
+
+		for _, name := range []string{"My Drive", "Team"} {
+			names, err := dir.Readdirnames(1)
+			require.NoError(t, err)
+			require.Equal(t, []string{name}, names)
+		}
+
+		// Like with the other directories, the listing starts again
+		names, err := dir.Readdirnames(2)
+		require.NoError(t, err)
+		require.Equal(t, []string{"My Drive", "Team"}, names)
+		require.NoError(t, dir.Close())
+
+		fi, err := driver.Stat("Team")
+		require.NoError(t, err)
+		require.True(t, fi.IsDir())
+	})
+
+	t.Run("files", func(t *testing.T) {
+		mustWriteFileContent(t, driver, "Team/Folder1/File1", "Hello")
+		mustWriteFile(t, driver, "My Drive/File2")
+
+		require.Equal(t, []string{"Folder1"}, listNames(t, "Team"))
+		require.Equal(t, []string{"File1"}, listNames(t, "Team/Folder1"))
+		require.Equal(t, []string{"File2"}, listNames(t, "My Drive"))
+
+		mustReadFileContent(t, driver, "Team/Folder1/File1", "Hello")
+
+		require.NoError(t, driver.Rename("Team/Folder1/File1", "Team/File1"))
+		require.Equal(t, []string{"File1", "Folder1"}, listNames(t, "Team"))
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		require.Equal(t, ErrForbiddenOnRoot, driver.Mkdir("Other", os.FileMode(0)))
+		require.Equal(t, ErrForbiddenOnRoot, driver.RemoveAll("Team"))
+		require.Equal(t, ErrForbiddenOnRoot, driver.Rename("Team/File1", "File1"))
+		require.Equal(t, ErrForbiddenOnRoot, driver.Rename("Team", "My Drive/Team"))
+
+		_, err := driver.OpenFile("File3", os.O_WRONLY|os.O_CREATE, os.FileMode(0))
+		require.Equal(t, ErrForbiddenOnRoot, err)
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		driver.TrashForDelete = true
+		defer func() { driver.TrashForDelete = false }()
+
+		require.NoError(t, driver.Remove("Team/File1"))
+
+		trashed, err := driver.ListTrash("", 0)
+		require.NoError(t, err)
+		require.Len(t, trashed, 1)
+		require.Equal(t, "Team/File1", trashed[0].Path())
+	})
+
+	t.Run("root directory", func(t *testing.T) {
+		sub := reopen(t, server, driver, RootDirectory("Team/Folder1"))
+
+		mustWriteFile(t, sub, "File4")
+
+		// The file was written by another client, our listing of the folder is stale
+		driver.srvWrapper.cache.CleanupEverything()
+		require.Equal(t, []string{"File4"}, listNames(t, "Team/Folder1"))
+	})
+}
@@ -0,0 +1,426 @@
+package gdrive // nolint: golint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// trashedFields are the fields of the trashed files
+var trashedFields = googleapi.Field(fmt.Sprintf(
+	"nextPageToken,files(%s,explicitlyTrashed,parents,trashedTime,trashingUser(displayName,emailAddress))",
+	googleapi.CombineFields(fileInfoFields),
+))
+
+// trashedFile is a trashed file under the root directory
+type trashedFile struct {
+	file       *drive.File
+	parentPath string // parentPath is the path of its folder from the root directory
+	live       bool   // live is set when the folders of its path aren't trashed
+}
+
+// trashResolver finds the paths of the trashed files from a root folder, each folder being fetched once
+type trashResolver struct {
+	driver  *GDriver
+	rootID  string
+	folders map[string]*drive.File // folders are the folders fetched, nil for the ones that don't exist anymore
+}
+
+func (d *GDriver) newTrashResolver(rootID string) *trashResolver {
+	return &trashResolver{driver: d, rootID: rootID, folders: make(map[string]*drive.File)}
+}
+
+// folder returns a folder, nil if it doesn't exist anymore
+func (r *trashResolver) folder(id string) (*drive.File, error) {
+	if folder, ok := r.folders[id]; ok {
+		return folder, nil
+	}
+
+	var folder *drive.File
+
+	err := r.driver.callAPI(CallRead, true, func() error {
+		var err error
+		folder, err = r.driver.srv.Files.Get(id).
+			Fields("id,name,parents,trashed").
+			SupportsAllDrives(true).
+			Context(r.driver.Context()).
+			Do()
+
+		return err
+	})
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		folder, err = nil, nil
+	}
+
+	if err != nil {
+		return nil, &DriveAPICallError{Err: err}
+	}
+
+	r.folders[id] = folder
+
+	return folder, nil
+}
+
+// parentPath returns the path of the folder of a file from the root folder, if the file is under it, and whether the
+// folders of the path are all live
+func (r *trashResolver) parentPath(file *drive.File) (string, bool, bool, error) {
+	for _, parentID := range file.Parents {
+		if parentID == r.rootID {
+			return "", true, true, nil
+		}
+
+		parent, err := r.folder(parentID)
+		if err != nil {
+			return "", false, false, err
+		}
+
+		if parent == nil {
+			continue
+		}
+
+		parentPath, inRoot, live, err := r.parentPath(parent)
+		if err != nil {
+			return "", false, false, err
+		}
+
+		if inRoot {
+			return path.Join(parentPath, parent.Name), true, live && !parent.Trashed, nil
+		}
+	}
+
+	return "", false, false, nil
+}
+
+// trashRoots returns the folders whose trash is handled, with the path they have from the root directory. It's the
+// root directory, or the drives if it's the virtual root.
+func (d *GDriver) trashRoots() ([]*FileInfo, []string, error) {
+	if !d.rootNode.isVirtual() {
+		return []*FileInfo{d.rootNode}, []string{""}, nil
+	}
+
+	roots, err := d.virtualRootEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefixes := make([]string, 0, len(roots))
+	for _, root := range roots {
+		prefixes = append(prefixes, root.Name())
+	}
+
+	return roots, prefixes, nil
+}
+
+// TrashIterator goes through the trashed files under a directory, including the ones trashed with their folder. The
+// files are listed page by page, and the folders of their paths are fetched once for the whole iteration.
+type TrashIterator struct {
+	driver    *GDriver
+	roots     []*FileInfo // roots are the folders whose trashed files are left to go through
+	prefixes  []string    // prefixes are the paths given to the roots
+	resolver  *trashResolver
+	pageSize  int64
+	pageToken string        // pageToken is the token of the next page of the first root, if any
+	page      []*drive.File // page are the files of the current page not handled yet
+	started   bool          // started is set once the first page of the first root was fetched
+}
+
+func (d *GDriver) newTrashIterator(roots []*FileInfo, prefixes []string) *TrashIterator {
+	return &TrashIterator{
+		driver:   d,
+		roots:    roots,
+		prefixes: prefixes,
+		resolver: d.newTrashResolver(""),
+		pageSize: filesListPageSizeMax,
+	}
+}
+
+// IterateTrash returns an iterator over the trashed files under a directory. Like with ListTrash, their paths start
+// with the path of the directory.
+func (d *GDriver) IterateTrash(filePath string) (*TrashIterator, error) {
+	file, err := d.getFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each drive has its own trash
+	if file.isVirtual() {
+		roots, prefixes, err := d.trashRoots()
+		if err != nil {
+			return nil, err
+		}
+
+		return d.newTrashIterator(roots, prefixes), nil
+	}
+
+	return d.newTrashIterator([]*FileInfo{file}, []string{file.Path()}), nil
+}
+
+// Next returns the next trashed file, or io.EOF once they were all returned. Its FileInfo gives the time it was
+// trashed and the user who trashed it (see FileInfo.TrashedTime and FileInfo.TrashingUser).
+func (it *TrashIterator) Next() (*FileInfo, error) {
+	t, err := it.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return it.driver.newFileInfo(t.file, t.parentPath), nil
+}
+
+func (it *TrashIterator) next() (*trashedFile, error) {
+	for {
+		for len(it.page) > 0 {
+			file := it.page[0]
+
+			parentPath, inRoot, live, err := it.resolver.parentPath(file)
+			if err != nil {
+				return nil, err
+			}
+
+			it.page = it.page[1:]
+
+			if inRoot {
+				return &trashedFile{file: file, parentPath: path.Join(it.prefixes[0], parentPath), live: live}, nil
+			}
+		}
+
+		if it.started && it.pageToken == "" {
+			it.roots, it.prefixes = it.roots[1:], it.prefixes[1:]
+			it.started = false
+		}
+
+		if len(it.roots) == 0 {
+			return nil, io.EOF
+		}
+
+		if err := it.fetchPage(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchPage fetches the next page of the trashed files of the drive of the first root
+func (it *TrashIterator) fetchPage() error {
+	d := it.driver
+	root := it.roots[0]
+
+	call := inDrive(d.srv.Files.List(), root.file.DriveId).
+		Q("trashed = true").
+		Fields(trashedFields).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		PageSize(it.pageSize)
+
+	if it.pageToken != "" {
+		call = call.PageToken(it.pageToken)
+	}
+
+	var files *drive.FileList
+
+	err := d.callAPI(CallRead, true, func() error {
+		var err error
+		files, err = call.Context(d.Context()).Do()
+
+		return err
+	})
+	if err != nil {
+		return &DriveAPICallError{Err: err}
+	}
+
+	// The folders fetched for a root are kept for the next ones, only the paths change
+	it.resolver.rootID = root.file.Id
+	it.page, it.pageToken, it.started = files.Files, files.NextPageToken, true
+
+	return nil
+}
+
+// ListTrash lists the trashed files under a directory (including the ones trashed with their folder), at most count
+// of them if it's positive. Their paths start with the path of the directory.
+func (d *GDriver) ListTrash(filePath string, count int) ([]*FileInfo, error) {
+	it, err := d.IterateTrash(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 && count < filesListPageSizeMax {
+		it.pageSize = int64(count)
+	}
+
+	var list []*FileInfo
+
+	for count <= 0 || len(list) < count {
+		fi, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, fi)
+	}
+
+	return list, nil
+}
+
+// listTrashed lists the trashed files under some roots, including the ones trashed with their folder
+func (d *GDriver) listTrashed(roots []*FileInfo, prefixes []string) ([]*trashedFile, error) {
+	it := d.newTrashIterator(roots, prefixes)
+
+	var list []*trashedFile
+
+	for {
+		t, err := it.next()
+		if errors.Is(err, io.EOF) {
+			return list, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, t)
+	}
+}
+
+// RestoreFromTrash restores a trashed file or directory, identified by the path it had. If its directory doesn't
+// exist anymore (because it was trashed too), it's created again.
+func (d *GDriver) RestoreFromTrash(filePath string) error {
+	pathParts := strings.FieldsFunc(filePath, isPathSeperator)
+	if len(pathParts) == 0 {
+		return ErrForbiddenOnRoot
+	}
+
+	filePath = path.Join(pathParts...)
+
+	roots, prefixes, err := d.trashRoots()
+	if err != nil {
+		return err
+	}
+
+	trashed, err := d.listTrashed(roots, prefixes)
+	if err != nil {
+		return err
+	}
+
+	var found *trashedFile
+
+	for _, t := range trashed {
+		if strings.EqualFold(d.newFileInfo(t.file, t.parentPath).Path(), filePath) {
+			if found != nil {
+				return &FileHasMultipleEntriesError{Path: filePath}
+			}
+
+			found = t
+		}
+	}
+
+	if found == nil {
+		return &FileNotExistError{Path: filePath}
+	}
+
+	var target *drive.File
+
+	if !found.live {
+		dir, err := d.makeDirectoryByParts(pathParts[:len(pathParts)-1])
+		if err != nil {
+			return err
+		}
+
+		if dir.isVirtual() {
+			return ErrForbiddenOnRoot
+		}
+
+		target = dir.file
+	}
+
+	_, err = d.srvWrapper.restoreFile(found.file, target)
+
+	return err
+}
+
+// EmptyTrash permanently deletes all the trashed files of the drive of the root directory (or of all the drives if
+// it's the virtual root), including the ones that aren't under the root directory
+func (d *GDriver) EmptyTrash() error {
+	roots, _, err := d.trashRoots()
+	if err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		if root.file.DriveId == "" {
+			err = d.callAPI(CallWrite, true, func() error {
+				return d.srv.Files.EmptyTrash().Context(d.Context()).Do()
+			})
+			if err != nil {
+				return &DriveAPICallError{Err: err}
+			}
+
+			continue
+		}
+
+		// The trash of the shared drives has to be emptied file by file
+		driveRoot := &FileInfo{file: &drive.File{Id: root.file.DriveId, DriveId: root.file.DriveId}}
+		if err := d.purgeTrash([]*FileInfo{driveRoot}, []string{""}, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PurgeTrash permanently deletes the files under the root directory that were trashed for longer than olderThan
+func (d *GDriver) PurgeTrash(olderThan time.Duration) error {
+	roots, prefixes, err := d.trashRoots()
+	if err != nil {
+		return err
+	}
+
+	return d.purgeTrash(roots, prefixes, time.Now().Add(-olderThan))
+}
+
+// purgeTrash permanently deletes the files under some roots that were trashed before a time, or all of them if it's
+// zero
+func (d *GDriver) purgeTrash(roots []*FileInfo, prefixes []string, before time.Time) error {
+	trashed, err := d.listTrashed(roots, prefixes)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range trashed {
+		// The files trashed with their folder are deleted with it
+		if !t.file.ExplicitlyTrashed {
+			continue
+		}
+
+		if !before.IsZero() {
+			trashedTime, err := time.Parse(time.RFC3339, t.file.TrashedTime)
+			if err != nil || !trashedTime.Before(before) {
+				continue
+			}
+		}
+
+		err := d.srvWrapper.deleteFile(t.file, false)
+
+		// It might have been deleted with a folder
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package gdrive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/jonny5532/afero-gdrive/drivetest"
+)
+
+func TestTrashManagement(t *testing.T) {
+	// The trash is shared by the whole drive, emptying it would interfere with the other tests on a real drive
+	driver, _ := setupFake(t)
+
+	driver.TrashForDelete = true
+
+	trashedPaths := func() []string {
+		roots, prefixes, err := driver.trashRoots()
+		require.NoError(t, err)
+
+		trashed, err := driver.listTrashed(roots, prefixes)
+		require.NoError(t, err)
+
+		paths := make([]string, 0, len(trashed))
+		for _, t := range trashed {
+			paths = append(paths, driver.newFileInfo(t.file, t.parentPath).Path())
+		}
+
+		return paths
+	}
+
+	mustWriteFileContent(t, driver, "Folder1/File1", "one")
+	mustWriteFileContent(t, driver, "Folder1/File2", "two")
+	mustWriteFileContent(t, driver, "File3", "three")
+
+	t.Run("restore", func(t *testing.T) {
+		require.NoError(t, driver.Remove("Folder1/File1"))
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File1"))))
+
+		require.True(t, IsNotExist(driver.RestoreFromTrash("Folder1/File3")))
+		require.NoError(t, driver.RestoreFromTrash("Folder1/File1"))
+		mustReadFileContent(t, driver, "Folder1/File1", "one")
+	})
+
+	t.Run("restore in a trashed folder", func(t *testing.T) {
+		require.NoError(t, driver.Remove("Folder1/File2"))
+		require.NoError(t, driver.Remove("Folder1"))
+		require.ElementsMatch(t, []string{"Folder1", "Folder1/File1", "Folder1/File2"}, trashedPaths())
+
+		// The folder is created again
+		require.NoError(t, driver.RestoreFromTrash("Folder1/File2"))
+		mustReadFileContent(t, driver, "Folder1/File2", "two")
+		require.True(t, IsNotExist(getError(driver.Stat("Folder1/File1"))))
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		require.NoError(t, driver.PurgeTrash(time.Hour))
+		require.ElementsMatch(t, []string{"Folder1", "Folder1/File1"}, trashedPaths())
+
+		time.Sleep(2 * time.Millisecond)
+
+		require.NoError(t, driver.PurgeTrash(0))
+		require.Empty(t, trashedPaths())
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		require.NoError(t, driver.Remove("File3"))
+		require.NoError(t, driver.MkdirAll("Folder2", os.FileMode(0700)))
+		require.NoError(t, driver.Remove("Folder2"))
+		require.Len(t, trashedPaths(), 2)
+
+		require.NoError(t, driver.EmptyTrash())
+		require.Empty(t, trashedPaths())
+		mustReadFileContent(t, driver, "Folder1/File2", "two")
+	})
+}
+
+// listingCounter counts the requests listing the files and the ones getting a file
+type listingCounter struct {
+	base  http.RoundTripper
+	lists int32
+	gets  int32
+}
+
+func (c *listingCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet && req.URL.Query().Get("alt") != "media" {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/files"):
+			atomic.AddInt32(&c.lists, 1)
+		case strings.Contains(req.URL.Path, "/files/"):
+			atomic.AddInt32(&c.gets, 1)
+		}
+	}
+
+	return c.base.RoundTrip(req)
+}
+
+func (c *listingCounter) reset() {
+	atomic.StoreInt32(&c.lists, 0)
+	atomic.StoreInt32(&c.gets, 0)
+}
+
+// countListings starts counting the listings and the files gotten by a driver
+func countListings(driver *GDriver) *listingCounter {
+	counter := &listingCounter{base: driver.client.Transport}
+	driver.client.Transport = counter
+
+	return counter
+}
+
+func TestTrashIterator(t *testing.T) {
+	// The listings of the trash are counted, it must only have the files of the test
+	driver, _ := setupFake(t)
+	counter := countListings(driver)
+
+	driver.TrashForDelete = true
+
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("Folder1/Sub/File%d", i)
+		mustWriteFile(t, driver, name)
+		require.NoError(t, driver.Remove(name))
+	}
+
+	mustWriteFile(t, driver, "Folder2/File")
+	require.NoError(t, driver.Remove("Folder2"))
+	mustWriteFile(t, driver, "File3")
+	require.NoError(t, driver.Remove("File3"))
+
+	t.Run("pages", func(t *testing.T) {
+		counter.reset()
+
+		it, err := driver.IterateTrash("")
+		require.NoError(t, err)
+
+		it.pageSize = 4
+
+		var paths []string
+
+		for {
+			fi, err := it.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			require.NoError(t, err)
+			require.False(t, fi.TrashedTime().IsZero())
+			require.Equal(t, drivetest.User.EmailAddress, fi.TrashingUser().EmailAddress)
+
+			paths = append(paths, fi.Path())
+		}
+
+		require.Len(t, paths, 13)
+		// Like with ListTrash, the paths start with the name of the root directory
+		require.Contains(t, paths, path.Join(driver.rootNode.Name(), "Folder1/Sub/File9"))
+		require.Contains(t, paths, path.Join(driver.rootNode.Name(), "Folder2/File"))
+
+		// Each folder is only fetched once: Sub, Folder1 and Folder2
+		require.EqualValues(t, 4, atomic.LoadInt32(&counter.lists))
+		require.EqualValues(t, 3, atomic.LoadInt32(&counter.gets))
+	})
+
+	t.Run("count", func(t *testing.T) {
+		files, err := driver.ListTrash("Folder1", 0)
+		require.NoError(t, err)
+		require.Len(t, files, 10)
+
+		for _, fi := range files {
+			require.True(t, strings.HasPrefix(fi.Path(), "Folder1/Sub/File"), fi.Path())
+		}
+
+		files, err = driver.ListTrash("", 5)
+		require.NoError(t, err)
+		require.Len(t, files, 5)
+	})
+}